@@ -21,11 +21,15 @@ import (
 	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress"
 
 	// This defines the shared main for injected controllers.
+	filteredinformerfactory "knative.dev/pkg/client/injection/kube/informers/factory/filtered"
 	"knative.dev/pkg/injection/sharedmain"
+	"knative.dev/pkg/signals"
 )
 
 func main() {
-	sharedmain.Main("net-gateway-api-controller",
+	ctx := filteredinformerfactory.WithSelectors(signals.NewContext(), ingress.SecretSelectors...)
+	sharedmain.MainWithContext(ctx, "net-gateway-api-controller",
 		ingress.NewController,
+		ingress.NewManagedGatewayController,
 	)
 }
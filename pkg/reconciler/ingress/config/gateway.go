@@ -20,7 +20,10 @@ import (
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/tools/cache"
+	gwv1alpha1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
 	"sigs.k8s.io/yaml"
 
 	"knative.dev/networking/pkg/apis/networking/v1alpha1"
@@ -34,6 +37,10 @@ const (
 
 	visibilityConfigKey = "visibility"
 
+	// hostRewritesConfigKey is the key of the host rewrite filters by
+	// GatewayClass.
+	hostRewritesConfigKey = "hostRewrites"
+
 	// defaultGatewayClass is the gatewayclass name for the gateway.
 	defaultGatewayClass = "istio"
 
@@ -48,26 +55,156 @@ const (
 
 	// defaultGatewayService is the default gateway service.
 	defaultGatewayService = "istio-system/istio-ingressgateway"
+
+	// GatewayAnnotationKey is the annotation of the Ingress to route it
+	// through another Gateway than the one of the visibility. The Gateway
+	// must be allowed by the visibility in allowedGateways.
+	GatewayAnnotationKey = "gateway-api.networking.knative.dev/gateway"
+)
+
+// ReadinessStrategy is the way how the readiness of the Ingress is verified
+// on the gateway.
+type ReadinessStrategy string
+
+const (
+	// ReadinessPodProbe probes the pods behind the gateway service. This is
+	// the default strategy.
+	ReadinessPodProbe ReadinessStrategy = "PodProbe"
+
+	// ReadinessGatewayProbe probes the addresses of the Gateway. This is for
+	// the implementations which do not run the gateway pods in the cluster.
+	ReadinessGatewayProbe ReadinessStrategy = "GatewayProbe"
+
+	// ReadinessConditions trusts the Admitted condition of the HTTPRoutes and
+	// the Ready condition of the Gateway without probing.
+	ReadinessConditions ReadinessStrategy = "Conditions"
 )
 
 type GatewayConfig struct {
 	GatewayClass string `json:"class,omitempty"`
 	Gateway      string `json:"gateway,omitempty"`
 	Service      string `json:"service,omitempty"`
+
+	// Readiness is the strategy to verify the readiness of the Ingress.
+	Readiness ReadinessStrategy `json:"readiness,omitempty"`
+
+	// Probe overrides the ports of the gateway pods to probe.
+	Probe *ProbeConfig `json:"probe,omitempty"`
+
+	// Managed makes the controller provision the Gateway.
+	Managed *ManagedGateway `json:"managed,omitempty"`
+
+	// HTTPRedirect is the ExtensionRef filter which redirects plain HTTP
+	// requests to HTTPS. It is resolved in the namespace of the HTTPRoute.
+	HTTPRedirect *gwv1alpha1.LocalObjectReference `json:"httpRedirect,omitempty"`
+
+	// AllowedGateways are the Gateways which the Ingresses may select with
+	// the gateway annotation instead of the Gateway of the visibility.
+	AllowedGateways []AllowedGateway `json:"allowedGateways,omitempty"`
+
+	// Selectors route the Ingresses which they match through other Gateways
+	// than the Gateway of the visibility.
+	Selectors []GatewaySelector `json:"selectors,omitempty"`
+
+	// AdditionalGateways are the Gateways which the HTTPRoutes of the
+	// visibility are attached to besides the Gateway of the Ingress.
+	AdditionalGateways []AdditionalGateway `json:"additionalGateways,omitempty"`
+
+	// Quorum is the number of the Gateways of the visibility which must admit
+	// the HTTPRoutes for the Ingress to be ready. Defaults to all of them. It
+	// requires the Conditions readiness, as the probes go to all Gateways.
+	Quorum int `json:"quorum,omitempty"`
+}
+
+// AdditionalGateway is a Gateway which the HTTPRoutes are also attached to.
+type AdditionalGateway struct {
+	// Gateway is the namespace/name of the Gateway.
+	Gateway string `json:"gateway"`
+	// Service is the namespace/name of the Service for the Gateway.
+	Service string `json:"service"`
+}
+
+// GatewaySelector routes the Ingresses whose namespace and labels match the
+// selectors through its Gateway. When several selectors match, the one with
+// the most requirements wins, and the first one among them.
+type GatewaySelector struct {
+	// NamespaceSelector matches the labels of the Ingress namespace.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// IngressSelector matches the labels of the Ingress.
+	IngressSelector *metav1.LabelSelector `json:"ingressSelector,omitempty"`
+	// Gateway is the namespace/name of the Gateway.
+	Gateway string `json:"gateway"`
+	// Service is the namespace/name of the Service for the Gateway. Defaults
+	// to the Service of the visibility.
+	Service string `json:"service,omitempty"`
+}
+
+// AllowedGateway is a Gateway which the Ingresses may select by annotation.
+type AllowedGateway struct {
+	// Gateway is the namespace/name of the Gateway.
+	Gateway string `json:"gateway"`
+	// Service is the namespace/name of the Service for the Gateway. Defaults
+	// to the Service of the visibility.
+	Service string `json:"service,omitempty"`
 }
 
-// Gateway maps gateways to routes by matching the gateway's
-// label selectors to the route's labels.
+// ProbeConfig is the scheme and the container ports of the gateway pods to
+// probe. The ports which are not set are derived from the Gateway listener and
+// the targetPort of the gateway service.
+type ProbeConfig struct {
+	// Scheme is the scheme to probe with, "http" or "https". Defaults to
+	// "https" for the ExternalIP rules of the Ingresses with HTTPOption
+	// Redirected and to "http" otherwise.
+	Scheme string `json:"scheme,omitempty"`
+	// HTTPPort is the port to probe with plain HTTP.
+	HTTPPort int32 `json:"httpPort,omitempty"`
+	// HTTPSPort is the port to probe with HTTPS.
+	HTTPSPort int32 `json:"httpsPort,omitempty"`
+}
+
+// ManagedGateway is the Gateway which the controller provisions and keeps in
+// sync with this configuration.
+type ManagedGateway struct {
+	// Addresses requested for the Gateway.
+	Addresses []gwv1alpha1.GatewayAddress `json:"addresses,omitempty"`
+
+	// Listeners of the Gateway. Their routes are set by the controller to
+	// select the HTTPRoutes of the visibility. Defaults to a single HTTP
+	// listener on port 80.
+	Listeners []gwv1alpha1.Listener `json:"listeners,omitempty"`
+}
+
+// Gateway maps the Ingresses to gateways by their visibility, and by matching
+// the labels of the Ingresses and their namespaces to the selectors of the
+// visibility.
 type Gateway struct {
-	// Gateways map from gateway to label selector.  If a route has
-	// labels matching a particular selector, it will use the
-	// corresponding gateway.  If multiple selectors match, we choose
-	// the most specific selector.
+	// Gateways map from visibility to its gateways. If an Ingress matches
+	// the selectors of the visibility, it will use the corresponding
+	// gateway. If multiple selectors match, we choose the most specific
+	// selector.
 	Gateways map[v1alpha1.IngressVisibility]*GatewayConfig
+
+	// HostRewrites map from GatewayClass to the ExtensionRef filter which
+	// rewrites the Host header on its Gateways. The filter sets the Host
+	// header to the value of the K-Rewrite-Host header, which the HTTPRoutes
+	// set on the requests of the paths with a RewriteHost, and removes the
+	// latter. It is resolved in the namespace of the HTTPRoute.
+	HostRewrites map[string]gwv1alpha1.LocalObjectReference
 }
 
 // NewGatewayFromConfigMap creates a Gateway from the supplied ConfigMap
 func NewGatewayFromConfigMap(configMap *corev1.ConfigMap) (*Gateway, error) {
+	hostRewrites := make(map[string]gwv1alpha1.LocalObjectReference)
+	if err := yaml.Unmarshal([]byte(configMap.Data[hostRewritesConfigKey]), &hostRewrites); err != nil {
+		return nil, err
+	}
+	for class, r := range hostRewrites {
+		// The API server rejects the HTTPRoutes with an ExtensionRef missing any.
+		if r.Group == "" || r.Kind == "" || r.Name == "" {
+			return nil, fmt.Errorf("host rewrite of GatewayClass %q must set group, kind and name", class)
+		}
+	}
+
 	v, ok := configMap.Data[visibilityConfigKey]
 	if !ok {
 		// These are the defaults.
@@ -76,6 +213,7 @@ func NewGatewayFromConfigMap(configMap *corev1.ConfigMap) (*Gateway, error) {
 				v1alpha1.IngressVisibilityExternalIP:   {GatewayClass: defaultGatewayClass, Gateway: defaultIstioGateway, Service: defaultGatewayService},
 				v1alpha1.IngressVisibilityClusterLocal: {GatewayClass: defaultGatewayClass, Gateway: defaultIstioLocalGateway, Service: defaultLocalGatewayService},
 			},
+			HostRewrites: hostRewrites,
 		}, nil
 	}
 
@@ -92,7 +230,10 @@ func NewGatewayFromConfigMap(configMap *corev1.ConfigMap) (*Gateway, error) {
 			return nil, fmt.Errorf("visibility %q must not be empty", vis)
 		}
 	}
-	c := Gateway{Gateways: map[v1alpha1.IngressVisibility]*GatewayConfig{}}
+	c := Gateway{
+		Gateways:     map[v1alpha1.IngressVisibility]*GatewayConfig{},
+		HostRewrites: hostRewrites,
+	}
 
 	for key, value := range entry {
 		key, value := key, value
@@ -118,11 +259,95 @@ func NewGatewayFromConfigMap(configMap *corev1.ConfigMap) (*Gateway, error) {
 			return nil, fmt.Errorf("visibility %q must set class", key)
 		}
 
+		// The API server rejects the HTTPRoutes with an ExtensionRef missing any.
+		if r := value.HTTPRedirect; r != nil && (r.Group == "" || r.Kind == "" || r.Name == "") {
+			return nil, fmt.Errorf("visibility %q must set group, kind and name of httpRedirect", key)
+		}
+
+		switch value.Readiness {
+		case "", ReadinessPodProbe, ReadinessGatewayProbe, ReadinessConditions:
+		default:
+			return nil, fmt.Errorf("visibility %q has unrecognized readiness: %q", key, value.Readiness)
+		}
+
+		if p := value.Probe; p != nil {
+			if !validPort(p.HTTPPort) || !validPort(p.HTTPSPort) {
+				return nil, fmt.Errorf("visibility %q has invalid probe ports: %+v", key, *p)
+			}
+			switch p.Scheme {
+			case "", "http", "https":
+			default:
+				return nil, fmt.Errorf("visibility %q has unrecognized probe scheme: %q", key, p.Scheme)
+			}
+		}
+
+		for _, a := range value.AllowedGateways {
+			if ns, name, err := cache.SplitMetaNamespaceKey(a.Gateway); err != nil || ns == "" || name == "" {
+				return nil, fmt.Errorf("visibility %q has invalid allowed gateway: %q", key, a.Gateway)
+			}
+			if _, _, err := cache.SplitMetaNamespaceKey(a.Service); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, sel := range value.Selectors {
+			if ns, name, err := cache.SplitMetaNamespaceKey(sel.Gateway); err != nil || ns == "" || name == "" {
+				return nil, fmt.Errorf("visibility %q has invalid selector gateway: %q", key, sel.Gateway)
+			}
+			if _, _, err := cache.SplitMetaNamespaceKey(sel.Service); err != nil {
+				return nil, err
+			}
+			if sel.NamespaceSelector == nil && sel.IngressSelector == nil {
+				return nil, fmt.Errorf("visibility %q must set namespaceSelector or ingressSelector of gateway %q", key, sel.Gateway)
+			}
+			for _, selector := range []*metav1.LabelSelector{sel.NamespaceSelector, sel.IngressSelector} {
+				if _, err := metav1.LabelSelectorAsSelector(selector); err != nil {
+					return nil, fmt.Errorf("visibility %q has invalid selector of gateway %q: %w", key, sel.Gateway, err)
+				}
+			}
+		}
+
+		for _, a := range value.AdditionalGateways {
+			if ns, name, err := cache.SplitMetaNamespaceKey(a.Gateway); err != nil || ns == "" || name == "" {
+				return nil, fmt.Errorf("visibility %q has invalid additional gateway: %q", key, a.Gateway)
+			}
+			if ns, name, err := cache.SplitMetaNamespaceKey(a.Service); err != nil || ns == "" || name == "" {
+				return nil, fmt.Errorf("visibility %q has invalid service of additional gateway %q: %q", key, a.Gateway, a.Service)
+			}
+		}
+
+		if value.Quorum < 0 || value.Quorum > len(value.AdditionalGateways)+1 {
+			return nil, fmt.Errorf("visibility %q has quorum %d out of its %d gateways", key, value.Quorum, len(value.AdditionalGateways)+1)
+		}
+		// The probing strategies need every gateway to serve the Ingress.
+		if value.Quorum != 0 && value.Readiness != ReadinessConditions {
+			return nil, fmt.Errorf("visibility %q must set readiness %q with quorum", key, ReadinessConditions)
+		}
+
+		if m := value.Managed; m != nil {
+			if ns, name, _ := cache.SplitMetaNamespaceKey(value.Gateway); ns == "" || name == "" {
+				return nil, fmt.Errorf("visibility %q must set the namespace/name of the managed gateway", key)
+			}
+			for _, l := range m.Listeners {
+				switch {
+				case l.Protocol != gwv1alpha1.HTTPProtocolType && l.Protocol != gwv1alpha1.HTTPSProtocolType:
+					return nil, fmt.Errorf("visibility %q has unsupported listener protocol: %q", key, l.Protocol)
+				case l.Protocol == gwv1alpha1.HTTPSProtocolType && l.TLS == nil:
+					return nil, fmt.Errorf("visibility %q must set tls of the HTTPS listener", key)
+				}
+			}
+		}
+
 		c.Gateways[key] = &value
 	}
 	return &c, nil
 }
 
+// validPort returns true if the port is unset or a valid port number.
+func validPort(port int32) bool {
+	return port >= 0 && port <= 65535
+}
+
 // LookupGateway returns a gateway given a visibility config.
 func (c *Gateway) LookupGateway(visibility v1alpha1.IngressVisibility) string {
 	if c.Gateways[visibility] == nil {
@@ -146,3 +371,223 @@ func (c *Gateway) LookupService(visibility v1alpha1.IngressVisibility) string {
 	}
 	return c.Gateways[visibility].Service
 }
+
+// LookupHTTPRedirect returns the HTTP to HTTPS redirect filter given a visibility config.
+func (c *Gateway) LookupHTTPRedirect(visibility v1alpha1.IngressVisibility) *gwv1alpha1.LocalObjectReference {
+	if c.Gateways[visibility] == nil {
+		return nil
+	}
+	return c.Gateways[visibility].HTTPRedirect
+}
+
+// LookupHostRewrite returns the host rewrite filter of the GatewayClass of the
+// given visibility, or nil if it has none.
+func (c *Gateway) LookupHostRewrite(visibility v1alpha1.IngressVisibility) *gwv1alpha1.LocalObjectReference {
+	r, ok := c.HostRewrites[c.LookupGatewayClass(visibility)]
+	if !ok {
+		return nil
+	}
+	return &r
+}
+
+// LookupReadiness returns the readiness strategy given a visibility config.
+func (c *Gateway) LookupReadiness(visibility v1alpha1.IngressVisibility) ReadinessStrategy {
+	if c.Gateways[visibility] == nil || c.Gateways[visibility].Readiness == "" {
+		return ReadinessPodProbe
+	}
+	return c.Gateways[visibility].Readiness
+}
+
+// LookupProbeScheme returns the scheme to probe the rule of the Ingress with
+// given a visibility config. Unless the scheme is configured, the ExternalIP
+// rules of the Ingresses with HTTPOption Redirected are probed with HTTPS, as
+// their plain HTTP requests are redirected.
+func (c *Gateway) LookupProbeScheme(ing *v1alpha1.Ingress, visibility v1alpha1.IngressVisibility) string {
+	if c.Gateways[visibility] != nil && c.Gateways[visibility].Probe != nil && c.Gateways[visibility].Probe.Scheme != "" {
+		return c.Gateways[visibility].Probe.Scheme
+	}
+	if visibility == v1alpha1.IngressVisibilityExternalIP && ing.Spec.HTTPOption == v1alpha1.HTTPOptionRedirected {
+		return "https"
+	}
+	return "http"
+}
+
+// LookupProbePort returns the port of the gateway pods to probe with the given
+// scheme, or zero if the port is not configured for the visibility.
+func (c *Gateway) LookupProbePort(visibility v1alpha1.IngressVisibility, scheme string) int32 {
+	if c.Gateways[visibility] == nil || c.Gateways[visibility].Probe == nil {
+		return 0
+	}
+	if scheme == "https" {
+		return c.Gateways[visibility].Probe.HTTPSPort
+	}
+	return c.Gateways[visibility].Probe.HTTPPort
+}
+
+// LookupManagedGateway returns the managed Gateway given a visibility config,
+// or nil if the Gateway is not managed by the controller.
+func (c *Gateway) LookupManagedGateway(visibility v1alpha1.IngressVisibility) *ManagedGateway {
+	if c.Gateways[visibility] == nil {
+		return nil
+	}
+	return c.Gateways[visibility].Managed
+}
+
+// LookupGatewayFor returns the gateway of the Ingress in a namespace with the
+// given labels given a visibility config. It is the Gateway of the gateway
+// annotation when the visibility allows it, then the Gateway of the most
+// specific selector matching the Ingress, and the gateway of the visibility
+// otherwise.
+func (c *Gateway) LookupGatewayFor(ing *v1alpha1.Ingress, namespaceLabels map[string]string,
+	visibility v1alpha1.IngressVisibility) string {
+	if a := c.lookupAllowedGateway(ing, visibility); a != nil {
+		return a.Gateway
+	}
+	if sel := c.lookupSelector(ing, namespaceLabels, visibility); sel != nil {
+		return sel.Gateway
+	}
+	return c.LookupGateway(visibility)
+}
+
+// LookupServiceFor returns the gateway service address of the Ingress given a
+// visibility config, following the Gateway selected like LookupGatewayFor.
+func (c *Gateway) LookupServiceFor(ing *v1alpha1.Ingress, namespaceLabels map[string]string,
+	visibility v1alpha1.IngressVisibility) string {
+	if a := c.lookupAllowedGateway(ing, visibility); a != nil {
+		if a.Service != "" {
+			return a.Service
+		}
+	} else if sel := c.lookupSelector(ing, namespaceLabels, visibility); sel != nil && sel.Service != "" {
+		return sel.Service
+	}
+	return c.LookupService(visibility)
+}
+
+// LookupGatewaysFor returns all the gateways which the HTTPRoutes of the
+// Ingress are attached to given a visibility config: the gateway of
+// LookupGatewayFor followed by the additional gateways of the visibility.
+func (c *Gateway) LookupGatewaysFor(ing *v1alpha1.Ingress, namespaceLabels map[string]string,
+	visibility v1alpha1.IngressVisibility) []string {
+	if c.Gateways[visibility] == nil {
+		return nil
+	}
+	gateways := []string{c.LookupGatewayFor(ing, namespaceLabels, visibility)}
+	for _, a := range c.Gateways[visibility].AdditionalGateways {
+		gateways = append(gateways, a.Gateway)
+	}
+	return gateways
+}
+
+// LookupServicesFor returns the gateway service addresses of the gateways of
+// LookupGatewaysFor, in the same order.
+func (c *Gateway) LookupServicesFor(ing *v1alpha1.Ingress, namespaceLabels map[string]string,
+	visibility v1alpha1.IngressVisibility) []string {
+	if c.Gateways[visibility] == nil {
+		return nil
+	}
+	services := []string{c.LookupServiceFor(ing, namespaceLabels, visibility)}
+	for _, a := range c.Gateways[visibility].AdditionalGateways {
+		services = append(services, a.Service)
+	}
+	return services
+}
+
+// LookupQuorum returns the number of the gateways which must admit the
+// HTTPRoutes given a visibility config.
+func (c *Gateway) LookupQuorum(visibility v1alpha1.IngressVisibility) int {
+	if c.Gateways[visibility] == nil {
+		return 0
+	}
+	if q := c.Gateways[visibility].Quorum; q > 0 {
+		return q
+	}
+	return len(c.Gateways[visibility].AdditionalGateways) + 1
+}
+
+// LookupServices returns the gateway service addresses of the visibility and
+// of the Gateways which the visibility allows, selects or adds.
+func (c *Gateway) LookupServices(visibility v1alpha1.IngressVisibility) []string {
+	if c.Gateways[visibility] == nil {
+		return nil
+	}
+	services := []string{c.Gateways[visibility].Service}
+	for _, a := range c.Gateways[visibility].AllowedGateways {
+		if a.Service != "" {
+			services = append(services, a.Service)
+		}
+	}
+	for _, sel := range c.Gateways[visibility].Selectors {
+		if sel.Service != "" {
+			services = append(services, sel.Service)
+		}
+	}
+	for _, a := range c.Gateways[visibility].AdditionalGateways {
+		services = append(services, a.Service)
+	}
+	return services
+}
+
+// IsGatewayAllowed returns true if the Ingress has no gateway annotation, or
+// if one of the given visibilities allows the Gateway of the annotation.
+func (c *Gateway) IsGatewayAllowed(ing *v1alpha1.Ingress, visibilities ...v1alpha1.IngressVisibility) bool {
+	if ing.Annotations[GatewayAnnotationKey] == "" {
+		return true
+	}
+	for _, visibility := range visibilities {
+		if c.lookupAllowedGateway(ing, visibility) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Gateway) lookupAllowedGateway(ing *v1alpha1.Ingress, visibility v1alpha1.IngressVisibility) *AllowedGateway {
+	key := ing.Annotations[GatewayAnnotationKey]
+	if key == "" || c.Gateways[visibility] == nil {
+		return nil
+	}
+	for i, a := range c.Gateways[visibility].AllowedGateways {
+		if a.Gateway == key {
+			return &c.Gateways[visibility].AllowedGateways[i]
+		}
+	}
+	return nil
+}
+
+// lookupSelector returns the most specific selector of the visibility which
+// matches the Ingress and the labels of its namespace, or nil if none does.
+func (c *Gateway) lookupSelector(ing *v1alpha1.Ingress, namespaceLabels map[string]string,
+	visibility v1alpha1.IngressVisibility) *GatewaySelector {
+	if c.Gateways[visibility] == nil {
+		return nil
+	}
+
+	var best *GatewaySelector
+	bestRequirements := -1
+	for i := range c.Gateways[visibility].Selectors {
+		sel := &c.Gateways[visibility].Selectors[i]
+		if !matches(sel.NamespaceSelector, namespaceLabels) || !matches(sel.IngressSelector, ing.Labels) {
+			continue
+		}
+		if n := requirements(sel.NamespaceSelector) + requirements(sel.IngressSelector); n > bestRequirements {
+			best, bestRequirements = sel, n
+		}
+	}
+	return best
+}
+
+// matches returns true if the selector is unset or matches the labels.
+func matches(selector *metav1.LabelSelector, set map[string]string) bool {
+	if selector == nil {
+		return true
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	return err == nil && s.Matches(labels.Set(set))
+}
+
+func requirements(selector *metav1.LabelSelector) int {
+	if selector == nil {
+		return 0
+	}
+	return len(selector.MatchLabels) + len(selector.MatchExpressions)
+}
@@ -19,6 +19,11 @@ package config
 import (
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"knative.dev/networking/pkg/apis/networking/v1alpha1"
+	gwv1alpha1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
+
 	. "knative.dev/pkg/configmap/testing"
 )
 
@@ -33,3 +38,787 @@ func TestGateway(t *testing.T) {
 		t.Error("NewContourFromConfigMap(example) =", err)
 	}
 }
+
+func TestGatewayHTTPRedirect(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		data    string
+		want    *gwv1alpha1.LocalObjectReference
+		wantErr bool
+	}{{
+		name: "no redirect",
+		data: `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`,
+	}, {
+		name: "redirect",
+		data: `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+  httpRedirect:
+    group: example.com
+    kind: Redirect
+    name: https
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`,
+		want: &gwv1alpha1.LocalObjectReference{
+			Group: "example.com",
+			Kind:  "Redirect",
+			Name:  "https",
+		},
+	}, {
+		name: "redirect without name",
+		data: `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+  httpRedirect:
+    group: example.com
+    kind: Redirect
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`,
+		wantErr: true,
+	}, {
+		name: "redirect without group",
+		data: `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+  httpRedirect:
+    kind: Redirect
+    name: https
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`,
+		wantErr: true,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NewGatewayFromConfigMap(&corev1.ConfigMap{
+				Data: map[string]string{visibilityConfigKey: tc.data},
+			})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("NewGatewayFromConfigMap() = %v, wantErr %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.want, got.LookupHTTPRedirect(v1alpha1.IngressVisibilityExternalIP)); diff != "" {
+				t.Error("LookupHTTPRedirect (-want, +got) =", diff)
+			}
+		})
+	}
+}
+
+func TestGatewayHostRewrite(t *testing.T) {
+	visibility := `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+ClusterLocal:
+  class: contour
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`
+
+	for _, tc := range []struct {
+		name      string
+		data      map[string]string
+		want      *gwv1alpha1.LocalObjectReference
+		wantLocal *gwv1alpha1.LocalObjectReference
+		wantErr   bool
+	}{{
+		name: "no host rewrite",
+		data: map[string]string{visibilityConfigKey: visibility},
+	}, {
+		name: "host rewrite of a GatewayClass",
+		data: map[string]string{
+			visibilityConfigKey: visibility,
+			hostRewritesConfigKey: `
+istio:
+  group: example.com
+  kind: HostRewrite
+  name: auto`,
+		},
+		want: &gwv1alpha1.LocalObjectReference{
+			Group: "example.com",
+			Kind:  "HostRewrite",
+			Name:  "auto",
+		},
+	}, {
+		name: "host rewrite with the default visibility",
+		data: map[string]string{
+			hostRewritesConfigKey: `
+istio:
+  group: example.com
+  kind: HostRewrite
+  name: auto`,
+		},
+		want: &gwv1alpha1.LocalObjectReference{
+			Group: "example.com",
+			Kind:  "HostRewrite",
+			Name:  "auto",
+		},
+		wantLocal: &gwv1alpha1.LocalObjectReference{
+			Group: "example.com",
+			Kind:  "HostRewrite",
+			Name:  "auto",
+		},
+	}, {
+		name: "host rewrite without kind",
+		data: map[string]string{
+			visibilityConfigKey: visibility,
+			hostRewritesConfigKey: `
+istio:
+  group: example.com
+  name: auto`,
+		},
+		wantErr: true,
+	}, {
+		name: "host rewrite without group",
+		data: map[string]string{
+			visibilityConfigKey: visibility,
+			hostRewritesConfigKey: `
+istio:
+  kind: HostRewrite
+  name: auto`,
+		},
+		wantErr: true,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NewGatewayFromConfigMap(&corev1.ConfigMap{Data: tc.data})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("NewGatewayFromConfigMap() = %v, wantErr %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.want, got.LookupHostRewrite(v1alpha1.IngressVisibilityExternalIP)); diff != "" {
+				t.Error("LookupHostRewrite(ExternalIP) (-want, +got) =", diff)
+			}
+			if diff := cmp.Diff(tc.wantLocal, got.LookupHostRewrite(v1alpha1.IngressVisibilityClusterLocal)); diff != "" {
+				t.Error("LookupHostRewrite(ClusterLocal) (-want, +got) =", diff)
+			}
+		})
+	}
+}
+
+func TestGatewayReadiness(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		data    string
+		want    ReadinessStrategy
+		wantErr bool
+	}{{
+		name: "default",
+		data: `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`,
+		want: ReadinessPodProbe,
+	}, {
+		name: "conditions",
+		data: `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+  readiness: Conditions
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`,
+		want: ReadinessConditions,
+	}, {
+		name: "unknown",
+		data: `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+  readiness: Guess
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`,
+		wantErr: true,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NewGatewayFromConfigMap(&corev1.ConfigMap{
+				Data: map[string]string{visibilityConfigKey: tc.data},
+			})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("NewGatewayFromConfigMap() = %v, wantErr %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := got.LookupReadiness(v1alpha1.IngressVisibilityExternalIP); got != tc.want {
+				t.Errorf("LookupReadiness() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGatewayProbePort(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		data       string
+		wantHTTP   int32
+		wantHTTPS  int32
+		wantScheme string
+		wantErr    bool
+	}{{
+		name: "not configured",
+		data: `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`,
+		wantScheme: "https",
+	}, {
+		name: "configured",
+		data: `
+ExternalIP:
+  class: contour
+  gateway: projectcontour/knative-gateway
+  service: projectcontour/envoy
+  probe:
+    scheme: http
+    httpPort: 8000
+    httpsPort: 8443
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`,
+		wantHTTP:   8000,
+		wantHTTPS:  8443,
+		wantScheme: "http",
+	}, {
+		name: "invalid port",
+		data: `
+ExternalIP:
+  class: contour
+  gateway: projectcontour/knative-gateway
+  service: projectcontour/envoy
+  probe:
+    httpPort: 80000
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`,
+		wantErr: true,
+	}, {
+		name: "invalid scheme",
+		data: `
+ExternalIP:
+  class: contour
+  gateway: projectcontour/knative-gateway
+  service: projectcontour/envoy
+  probe:
+    scheme: h2c
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`,
+		wantErr: true,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NewGatewayFromConfigMap(&corev1.ConfigMap{
+				Data: map[string]string{visibilityConfigKey: tc.data},
+			})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("NewGatewayFromConfigMap() = %v, wantErr %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := got.LookupProbePort(v1alpha1.IngressVisibilityExternalIP, "http"); got != tc.wantHTTP {
+				t.Errorf("LookupProbePort(http) = %d, want %d", got, tc.wantHTTP)
+			}
+			if got := got.LookupProbePort(v1alpha1.IngressVisibilityExternalIP, "https"); got != tc.wantHTTPS {
+				t.Errorf("LookupProbePort(https) = %d, want %d", got, tc.wantHTTPS)
+			}
+			redirected := &v1alpha1.Ingress{Spec: v1alpha1.IngressSpec{HTTPOption: v1alpha1.HTTPOptionRedirected}}
+			if got := got.LookupProbeScheme(redirected, v1alpha1.IngressVisibilityExternalIP); got != tc.wantScheme {
+				t.Errorf("LookupProbeScheme() = %q, want %q", got, tc.wantScheme)
+			}
+		})
+	}
+}
+
+func TestGatewayManaged(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		data    string
+		want    *ManagedGateway
+		wantErr bool
+	}{{
+		name: "not managed",
+		data: `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`,
+	}, {
+		name: "managed",
+		data: `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+  managed:
+    addresses:
+    - type: NamedAddress
+      value: istio-ingressgateway
+    listeners:
+    - protocol: HTTP
+      port: 80
+    - protocol: HTTPS
+      port: 443
+      tls:
+        mode: Terminate
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`,
+		want: &ManagedGateway{
+			Addresses: []gwv1alpha1.GatewayAddress{{
+				Type:  addressTypePtr(gwv1alpha1.NamedAddressType),
+				Value: "istio-ingressgateway",
+			}},
+			Listeners: []gwv1alpha1.Listener{{
+				Protocol: gwv1alpha1.HTTPProtocolType,
+				Port:     80,
+			}, {
+				Protocol: gwv1alpha1.HTTPSProtocolType,
+				Port:     443,
+				TLS: &gwv1alpha1.GatewayTLSConfig{
+					Mode: tlsModePtr(gwv1alpha1.TLSModeTerminate),
+				},
+			}},
+		},
+	}, {
+		name: "HTTPS listener without tls",
+		data: `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+  managed:
+    listeners:
+    - protocol: HTTPS
+      port: 443
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`,
+		wantErr: true,
+	}, {
+		name: "TCP listener",
+		data: `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+  managed:
+    listeners:
+    - protocol: TCP
+      port: 8000
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`,
+		wantErr: true,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NewGatewayFromConfigMap(&corev1.ConfigMap{
+				Data: map[string]string{visibilityConfigKey: tc.data},
+			})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("NewGatewayFromConfigMap() = %v, wantErr %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.want, got.LookupManagedGateway(v1alpha1.IngressVisibilityExternalIP)); diff != "" {
+				t.Error("LookupManagedGateway (-want, +got) =", diff)
+			}
+		})
+	}
+}
+
+func addressTypePtr(val gwv1alpha1.AddressType) *gwv1alpha1.AddressType {
+	return &val
+}
+
+func tlsModePtr(val gwv1alpha1.TLSModeType) *gwv1alpha1.TLSModeType {
+	return &val
+}
+
+func TestGatewayAllowedGateways(t *testing.T) {
+	got, err := NewGatewayFromConfigMap(&corev1.ConfigMap{
+		Data: map[string]string{visibilityConfigKey: `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+  allowedGateways:
+  - gateway: partner/partner-gateway
+    service: partner/partner-ingressgateway
+  - gateway: istio-system/shared-gateway
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`},
+	})
+	if err != nil {
+		t.Fatal("NewGatewayFromConfigMap() =", err)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		annotation  string
+		visibility  v1alpha1.IngressVisibility
+		wantGateway string
+		wantService string
+		wantAllowed bool
+	}{{
+		name:        "no annotation",
+		visibility:  v1alpha1.IngressVisibilityExternalIP,
+		wantGateway: "istio-system/knative-gateway",
+		wantService: "istio-system/istio-ingressgateway",
+		wantAllowed: true,
+	}, {
+		name:        "allowed gateway with service",
+		annotation:  "partner/partner-gateway",
+		visibility:  v1alpha1.IngressVisibilityExternalIP,
+		wantGateway: "partner/partner-gateway",
+		wantService: "partner/partner-ingressgateway",
+		wantAllowed: true,
+	}, {
+		name:        "allowed gateway without service",
+		annotation:  "istio-system/shared-gateway",
+		visibility:  v1alpha1.IngressVisibilityExternalIP,
+		wantGateway: "istio-system/shared-gateway",
+		wantService: "istio-system/istio-ingressgateway",
+		wantAllowed: true,
+	}, {
+		name:        "gateway not allowed by the visibility",
+		annotation:  "partner/partner-gateway",
+		visibility:  v1alpha1.IngressVisibilityClusterLocal,
+		wantGateway: "istio-system/knative-local-gateway",
+		wantService: "istio-system/knative-local-gateway",
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			ing := &v1alpha1.Ingress{}
+			if tc.annotation != "" {
+				ing.Annotations = map[string]string{GatewayAnnotationKey: tc.annotation}
+			}
+			if got := got.LookupGatewayFor(ing, nil, tc.visibility); got != tc.wantGateway {
+				t.Errorf("LookupGatewayFor() = %q, want %q", got, tc.wantGateway)
+			}
+			if got := got.LookupServiceFor(ing, nil, tc.visibility); got != tc.wantService {
+				t.Errorf("LookupServiceFor() = %q, want %q", got, tc.wantService)
+			}
+			if got := got.IsGatewayAllowed(ing, tc.visibility); got != tc.wantAllowed {
+				t.Errorf("IsGatewayAllowed() = %v, want %v", got, tc.wantAllowed)
+			}
+		})
+	}
+
+	if _, err := NewGatewayFromConfigMap(&corev1.ConfigMap{
+		Data: map[string]string{visibilityConfigKey: `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+  allowedGateways:
+  - gateway: partner-gateway
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`},
+	}); err == nil {
+		t.Error("NewGatewayFromConfigMap() = nil, want an error for the allowed gateway without namespace")
+	}
+}
+
+func TestGatewaySelectors(t *testing.T) {
+	got, err := NewGatewayFromConfigMap(&corev1.ConfigMap{
+		Data: map[string]string{visibilityConfigKey: `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+  selectors:
+  - namespaceSelector:
+      matchLabels:
+        region: eu
+    gateway: istio-system/eu-gateway
+    service: istio-system/eu-ingressgateway
+  - namespaceSelector:
+      matchLabels:
+        region: eu
+    ingressSelector:
+      matchLabels:
+        tenant: acme
+    gateway: acme/acme-gateway
+  - ingressSelector:
+      matchExpressions:
+      - key: tenant
+        operator: Exists
+    gateway: istio-system/tenant-gateway
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`},
+	})
+	if err != nil {
+		t.Fatal("NewGatewayFromConfigMap() =", err)
+	}
+
+	if diff := cmp.Diff([]string{
+		"istio-system/istio-ingressgateway",
+		"istio-system/eu-ingressgateway",
+	}, got.LookupServices(v1alpha1.IngressVisibilityExternalIP)); diff != "" {
+		t.Error("LookupServices (-want, +got) =", diff)
+	}
+
+	for _, tc := range []struct {
+		name            string
+		namespaceLabels map[string]string
+		ingressLabels   map[string]string
+		annotation      string
+		visibility      v1alpha1.IngressVisibility
+		wantGateway     string
+		wantService     string
+	}{{
+		name:        "no selector matches",
+		visibility:  v1alpha1.IngressVisibilityExternalIP,
+		wantGateway: "istio-system/knative-gateway",
+		wantService: "istio-system/istio-ingressgateway",
+	}, {
+		name:            "namespace selector",
+		namespaceLabels: map[string]string{"region": "eu"},
+		visibility:      v1alpha1.IngressVisibilityExternalIP,
+		wantGateway:     "istio-system/eu-gateway",
+		wantService:     "istio-system/eu-ingressgateway",
+	}, {
+		name:          "ingress selector",
+		ingressLabels: map[string]string{"tenant": "other"},
+		visibility:    v1alpha1.IngressVisibilityExternalIP,
+		wantGateway:   "istio-system/tenant-gateway",
+		wantService:   "istio-system/istio-ingressgateway",
+	}, {
+		name:            "most specific selector",
+		namespaceLabels: map[string]string{"region": "eu"},
+		ingressLabels:   map[string]string{"tenant": "acme"},
+		visibility:      v1alpha1.IngressVisibilityExternalIP,
+		wantGateway:     "acme/acme-gateway",
+		wantService:     "istio-system/istio-ingressgateway",
+	}, {
+		name:            "first of the equally specific selectors",
+		namespaceLabels: map[string]string{"region": "eu"},
+		ingressLabels:   map[string]string{"tenant": "other"},
+		visibility:      v1alpha1.IngressVisibilityExternalIP,
+		wantGateway:     "istio-system/eu-gateway",
+		wantService:     "istio-system/eu-ingressgateway",
+	}, {
+		name:            "selectors of another visibility",
+		namespaceLabels: map[string]string{"region": "eu"},
+		visibility:      v1alpha1.IngressVisibilityClusterLocal,
+		wantGateway:     "istio-system/knative-local-gateway",
+		wantService:     "istio-system/knative-local-gateway",
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			ing := &v1alpha1.Ingress{}
+			ing.Labels = tc.ingressLabels
+			if got := got.LookupGatewayFor(ing, tc.namespaceLabels, tc.visibility); got != tc.wantGateway {
+				t.Errorf("LookupGatewayFor() = %q, want %q", got, tc.wantGateway)
+			}
+			if got := got.LookupServiceFor(ing, tc.namespaceLabels, tc.visibility); got != tc.wantService {
+				t.Errorf("LookupServiceFor() = %q, want %q", got, tc.wantService)
+			}
+		})
+	}
+
+	for _, data := range []string{`
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+  selectors:
+  - gateway: istio-system/eu-gateway
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`, `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+  selectors:
+  - namespaceSelector:
+      matchLabels:
+        region: eu
+    gateway: eu-gateway
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`, `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+  selectors:
+  - ingressSelector:
+      matchExpressions:
+      - key: tenant
+        operator: Bogus
+    gateway: istio-system/tenant-gateway
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`} {
+		if _, err := NewGatewayFromConfigMap(&corev1.ConfigMap{
+			Data: map[string]string{visibilityConfigKey: data},
+		}); err == nil {
+			t.Errorf("NewGatewayFromConfigMap(%s) = nil, want an error", data)
+		}
+	}
+}
+
+func TestGatewayAdditionalGateways(t *testing.T) {
+	got, err := NewGatewayFromConfigMap(&corev1.ConfigMap{
+		Data: map[string]string{visibilityConfigKey: `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+  additionalGateways:
+  - gateway: istio-system/vpn-gateway
+    service: istio-system/vpn-ingressgateway
+  readiness: Conditions
+  quorum: 1
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`},
+	})
+	if err != nil {
+		t.Fatal("NewGatewayFromConfigMap() =", err)
+	}
+
+	ing := &v1alpha1.Ingress{}
+	if diff := cmp.Diff([]string{
+		"istio-system/knative-gateway",
+		"istio-system/vpn-gateway",
+	}, got.LookupGatewaysFor(ing, nil, v1alpha1.IngressVisibilityExternalIP)); diff != "" {
+		t.Error("LookupGatewaysFor (-want, +got) =", diff)
+	}
+	if diff := cmp.Diff([]string{
+		"istio-system/istio-ingressgateway",
+		"istio-system/vpn-ingressgateway",
+	}, got.LookupServicesFor(ing, nil, v1alpha1.IngressVisibilityExternalIP)); diff != "" {
+		t.Error("LookupServicesFor (-want, +got) =", diff)
+	}
+	if diff := cmp.Diff([]string{
+		"istio-system/istio-ingressgateway",
+		"istio-system/vpn-ingressgateway",
+	}, got.LookupServices(v1alpha1.IngressVisibilityExternalIP)); diff != "" {
+		t.Error("LookupServices (-want, +got) =", diff)
+	}
+	if got, want := got.LookupQuorum(v1alpha1.IngressVisibilityExternalIP), 1; got != want {
+		t.Errorf("LookupQuorum(ExternalIP) = %d, want %d", got, want)
+	}
+	if diff := cmp.Diff([]string{
+		"istio-system/knative-local-gateway",
+	}, got.LookupGatewaysFor(ing, nil, v1alpha1.IngressVisibilityClusterLocal)); diff != "" {
+		t.Error("LookupGatewaysFor (-want, +got) =", diff)
+	}
+	if got, want := got.LookupQuorum(v1alpha1.IngressVisibilityClusterLocal), 1; got != want {
+		t.Errorf("LookupQuorum(ClusterLocal) = %d, want %d", got, want)
+	}
+
+	for _, data := range []string{`
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+  additionalGateways:
+  - gateway: vpn-gateway
+    service: istio-system/vpn-ingressgateway
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`, `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+  additionalGateways:
+  - gateway: istio-system/vpn-gateway
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`, `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+  additionalGateways:
+  - gateway: istio-system/vpn-gateway
+    service: istio-system/vpn-ingressgateway
+  readiness: Conditions
+  quorum: 3
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`, `
+ExternalIP:
+  class: istio
+  gateway: istio-system/knative-gateway
+  service: istio-system/istio-ingressgateway
+  additionalGateways:
+  - gateway: istio-system/vpn-gateway
+    service: istio-system/vpn-ingressgateway
+  quorum: 1
+ClusterLocal:
+  class: istio
+  gateway: istio-system/knative-local-gateway
+  service: istio-system/knative-local-gateway`} {
+		if _, err := NewGatewayFromConfigMap(&corev1.ConfigMap{
+			Data: map[string]string{visibilityConfigKey: data},
+		}); err == nil {
+			t.Errorf("NewGatewayFromConfigMap(%s) = nil, want an error", data)
+		}
+	}
+}
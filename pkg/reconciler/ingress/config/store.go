@@ -26,6 +26,8 @@ import (
 
 type cfgKey struct{}
 
+type namespaceLabelsKey struct{}
+
 // Config is the configuration for the route reconciler.
 type Config struct {
 	Network *network.Config
@@ -52,6 +54,19 @@ func ToContext(ctx context.Context, c *Config) context.Context {
 	return context.WithValue(ctx, cfgKey{}, c)
 }
 
+// WithNamespaceLabels stores the labels of the namespace of the Ingress being
+// reconciled in the passed context, for the gateway selectors to match.
+func WithNamespaceLabels(ctx context.Context, labels map[string]string) context.Context {
+	return context.WithValue(ctx, namespaceLabelsKey{}, labels)
+}
+
+// NamespaceLabelsFromContext obtains the namespace labels injected into the
+// passed context, or nil if none are.
+func NamespaceLabelsFromContext(ctx context.Context) map[string]string {
+	labels, _ := ctx.Value(namespaceLabelsKey{}).(map[string]string)
+	return labels
+}
+
 // Store is a typed wrapper around configmap.Untyped store to handle our configmaps.
 //
 // +k8s:deepcopy-gen=false
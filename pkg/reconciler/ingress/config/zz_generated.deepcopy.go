@@ -21,10 +21,44 @@ limitations under the License.
 package config
 
 import (
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	pkg "knative.dev/networking/pkg"
 	v1alpha1 "knative.dev/networking/pkg/apis/networking/v1alpha1"
+	apisv1alpha1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdditionalGateway) DeepCopyInto(out *AdditionalGateway) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdditionalGateway.
+func (in *AdditionalGateway) DeepCopy() *AdditionalGateway {
+	if in == nil {
+		return nil
+	}
+	out := new(AdditionalGateway)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AllowedGateway) DeepCopyInto(out *AllowedGateway) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AllowedGateway.
+func (in *AllowedGateway) DeepCopy() *AllowedGateway {
+	if in == nil {
+		return nil
+	}
+	out := new(AllowedGateway)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Config) DeepCopyInto(out *Config) {
 	*out = *in
@@ -64,11 +98,18 @@ func (in *Gateway) DeepCopyInto(out *Gateway) {
 			} else {
 				in, out := &val, &outVal
 				*out = new(GatewayConfig)
-				**out = **in
+				(*in).DeepCopyInto(*out)
 			}
 			(*out)[key] = outVal
 		}
 	}
+	if in.HostRewrites != nil {
+		in, out := &in.HostRewrites, &out.HostRewrites
+		*out = make(map[string]apisv1alpha1.LocalObjectReference, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	return
 }
 
@@ -85,6 +126,38 @@ func (in *Gateway) DeepCopy() *Gateway {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GatewayConfig) DeepCopyInto(out *GatewayConfig) {
 	*out = *in
+	if in.Probe != nil {
+		in, out := &in.Probe, &out.Probe
+		*out = new(ProbeConfig)
+		**out = **in
+	}
+	if in.Managed != nil {
+		in, out := &in.Managed, &out.Managed
+		*out = new(ManagedGateway)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HTTPRedirect != nil {
+		in, out := &in.HTTPRedirect, &out.HTTPRedirect
+		*out = new(apisv1alpha1.LocalObjectReference)
+		**out = **in
+	}
+	if in.AllowedGateways != nil {
+		in, out := &in.AllowedGateways, &out.AllowedGateways
+		*out = make([]AllowedGateway, len(*in))
+		copy(*out, *in)
+	}
+	if in.Selectors != nil {
+		in, out := &in.Selectors, &out.Selectors
+		*out = make([]GatewaySelector, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AdditionalGateways != nil {
+		in, out := &in.AdditionalGateways, &out.AdditionalGateways
+		*out = make([]AdditionalGateway, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -97,3 +170,75 @@ func (in *GatewayConfig) DeepCopy() *GatewayConfig {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GatewaySelector) DeepCopyInto(out *GatewaySelector) {
+	*out = *in
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IngressSelector != nil {
+		in, out := &in.IngressSelector, &out.IngressSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GatewaySelector.
+func (in *GatewaySelector) DeepCopy() *GatewaySelector {
+	if in == nil {
+		return nil
+	}
+	out := new(GatewaySelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ManagedGateway) DeepCopyInto(out *ManagedGateway) {
+	*out = *in
+	if in.Addresses != nil {
+		in, out := &in.Addresses, &out.Addresses
+		*out = make([]apisv1alpha1.GatewayAddress, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Listeners != nil {
+		in, out := &in.Listeners, &out.Listeners
+		*out = make([]apisv1alpha1.Listener, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManagedGateway.
+func (in *ManagedGateway) DeepCopy() *ManagedGateway {
+	if in == nil {
+		return nil
+	}
+	out := new(ManagedGateway)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProbeConfig) DeepCopyInto(out *ProbeConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProbeConfig.
+func (in *ProbeConfig) DeepCopy() *ProbeConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ProbeConfig)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -19,8 +19,11 @@ package ingress
 import (
 	"context"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/cache"
+	gatewayv1alpha1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
 
 	network "knative.dev/networking/pkg"
 	"knative.dev/networking/pkg/apis/networking"
@@ -28,7 +31,11 @@ import (
 	ingressinformer "knative.dev/networking/pkg/client/injection/informers/networking/v1alpha1/ingress"
 	ingressreconciler "knative.dev/networking/pkg/client/injection/reconciler/networking/v1alpha1/ingress"
 	"knative.dev/networking/pkg/status"
-	endpointsinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/endpoints"
+	kubeclient "knative.dev/pkg/client/injection/kube/client"
+	namespaceinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/namespace"
+	secretinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/secret/filtered"
+	serviceinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/service"
+	endpointsliceinformer "knative.dev/pkg/client/injection/kube/informers/discovery/v1/endpointslice"
 	"knative.dev/pkg/configmap"
 	"knative.dev/pkg/controller"
 	"knative.dev/pkg/logging"
@@ -36,10 +43,24 @@ import (
 
 	gwapiclient "github.com/nak3/net-gateway-api/pkg/client/gatewayapi/injection/client"
 	gatewayinformer "github.com/nak3/net-gateway-api/pkg/client/gatewayapi/injection/informers/apis/v1alpha1/gateway"
+	gatewayclassinformer "github.com/nak3/net-gateway-api/pkg/client/gatewayapi/injection/informers/apis/v1alpha1/gatewayclass"
 	httprouteinformer "github.com/nak3/net-gateway-api/pkg/client/gatewayapi/injection/informers/apis/v1alpha1/httproute"
 	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/config"
 )
 
+// ingressClassFilter accepts the Ingresses of our class, which is the default.
+var ingressClassFilter = reconciler.AnnotationFilterFunc(networking.IngressClassAnnotationKey, GatewayAPIIngressClassName, true)
+
+// certificateUIDLabelKey is the label of the secrets of the Knative
+// Certificates, which the TLS secrets of the Ingresses usually are.
+const certificateUIDLabelKey = "networking.internal.knative.dev/certificate-uid"
+
+// SecretSelectors are the label selectors of the Secrets which the controller
+// caches: the copies of the TLS secrets it makes, and the secrets of the
+// Knative Certificates. They must be set up in the context with
+// filteredinformerfactory.WithSelectors.
+var SecretSelectors = []string{networking.OriginSecretNameLabelKey, certificateUIDLabelKey}
+
 // NewController initializes the controller and is called by the generated code
 // Registers eventhandlers to enqueue events
 func NewController(
@@ -51,15 +72,29 @@ func NewController(
 	ingressInformer := ingressinformer.Get(ctx)
 	httprouteInformer := httprouteinformer.Get(ctx)
 	gatewayInformer := gatewayinformer.Get(ctx)
-	endpointsInformer := endpointsinformer.Get(ctx)
+	gatewayClassInformer := gatewayclassinformer.Get(ctx)
+	endpointSliceInformer := endpointsliceinformer.Get(ctx)
+	namespaceInformer := namespaceinformer.Get(ctx)
+	secretInformer := secretinformer.Get(ctx, networking.OriginSecretNameLabelKey)
+	certificateSecretInformer := secretinformer.Get(ctx, certificateUIDLabelKey)
+	serviceInformer := serviceinformer.Get(ctx)
 
 	c := &Reconciler{
-		gwapiclient:     gwapiclient.Get(ctx),
-		httprouteLister: httprouteInformer.Lister(),
+		kubeclient:              kubeclient.Get(ctx),
+		gwapiclient:             gwapiclient.Get(ctx),
+		ingressLister:           ingressInformer.Lister(),
+		httprouteLister:         httprouteInformer.Lister(),
+		gatewayLister:           gatewayInformer.Lister(),
+		gatewayClassLister:      gatewayClassInformer.Lister(),
+		namespaceLister:         namespaceInformer.Lister(),
+		secretLister:            secretInformer.Lister(),
+		certificateSecretLister: certificateSecretInformer.Lister(),
+		serviceLister:           serviceInformer.Lister(),
 	}
 
-	filterFunc := reconciler.AnnotationFilterFunc(networking.IngressClassAnnotationKey, GatewayAPIIngressClassName, true)
+	filterFunc := ingressClassFilter
 
+	var configStore *config.Store
 	impl := ingressreconciler.NewImpl(ctx, c, GatewayAPIIngressClassName, func(impl *controller.Impl) controller.Options {
 		configsToResync := []interface{}{
 			&network.Config{},
@@ -68,7 +103,7 @@ func NewController(
 		resync := configmap.TypeFilter(configsToResync...)(func(string, interface{}) {
 			impl.GlobalResync(ingressInformer.Informer())
 		})
-		configStore := config.NewStore(logging.WithLogger(ctx, logger.Named("config-store")), resync)
+		configStore = config.NewStore(logging.WithLogger(ctx, logger.Named("config-store")), resync)
 		configStore.WatchConfigs(cmw)
 		return controller.Options{
 			ConfigStore:       configStore,
@@ -76,10 +111,37 @@ func NewController(
 		}
 	})
 
+	c.tracker = impl.Tracker
+
+	statusProber := status.NewProber(
+		logger.Named("status-manager"),
+		NewProbeTargetLister(logger, endpointSliceInformer.Lister(), gatewayInformer.Lister(), serviceInformer.Lister()),
+		func(ing *v1alpha1.Ingress) {
+			logger.Debugf("Ready callback triggered for ingress: %s/%s", ing.Namespace, ing.Name)
+			impl.EnqueueKey(types.NamespacedName{Namespace: ing.Namespace, Name: ing.Name})
+		})
+	c.statusManager = &gatewayConditionManager{
+		Manager:       statusProber,
+		gatewayLister: gatewayInformer.Lister(),
+	}
+	statusProber.Start(ctx.Done())
+
 	logger.Info("Setting up Ingress event handlers")
 	ingressHandler := cache.FilteringResourceEventHandler{
 		FilterFunc: filterFunc,
-		Handler:    controller.HandleAll(impl.Enqueue),
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc: impl.Enqueue,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				// The readiness is cached by the spec of the Ingress, so it
+				// is probed again through the Gateway of the new annotation.
+				oldIng, newIng := oldObj.(*v1alpha1.Ingress), newObj.(*v1alpha1.Ingress)
+				if oldIng.Annotations[config.GatewayAnnotationKey] != newIng.Annotations[config.GatewayAnnotationKey] {
+					statusProber.CancelIngressProbing(newIng)
+				}
+				impl.Enqueue(newObj)
+			},
+			DeleteFunc: impl.Enqueue,
+		},
 	}
 
 	ingressInformer.Informer().AddEventHandler(ingressHandler)
@@ -88,24 +150,74 @@ func NewController(
 		FilterFunc: filterFunc,
 		Handler:    controller.HandleAll(impl.EnqueueControllerOf),
 	})
-	gatewayInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
-		FilterFunc: filterFunc,
+	// Ingresses follow the Gateways and GatewayClasses they are routed through.
+	gatewayInformer.Informer().AddEventHandler(controller.HandleAll(
+		controller.EnsureTypeMeta(
+			impl.Tracker.OnChanged,
+			gatewayv1alpha1.SchemeGroupVersion.WithKind("Gateway"),
+		),
+	))
+	gatewayClassInformer.Informer().AddEventHandler(controller.HandleAll(
+		controller.EnsureTypeMeta(
+			impl.Tracker.OnChanged,
+			gatewayv1alpha1.SchemeGroupVersion.WithKind("GatewayClass"),
+		),
+	))
+	secretInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: controller.FilterControllerGK(v1alpha1.Kind("Ingress")),
 		Handler:    controller.HandleAll(impl.EnqueueControllerOf),
 	})
+	// Copied TLS secrets follow the secrets of the Knative Certificates.
+	certificateSecretInformer.Informer().AddEventHandler(controller.HandleAll(
+		controller.EnsureTypeMeta(
+			impl.Tracker.OnChanged,
+			corev1.SchemeGroupVersion.WithKind("Secret"),
+		),
+	))
+	// The gateway selectors follow the labels of the namespaces.
+	namespaceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNs, newNs := oldObj.(*corev1.Namespace), newObj.(*corev1.Namespace)
+			if equality.Semantic.DeepEqual(oldNs.Labels, newNs.Labels) {
+				return
+			}
+			// The readiness is cached by the spec of the Ingresses, so they
+			// are probed again through the Gateways of the new labels.
+			impl.FilteredGlobalResync(func(obj interface{}) bool {
+				ing, ok := obj.(*v1alpha1.Ingress)
+				if !ok || ing.Namespace != newNs.Name || !ingressClassFilter(ing) {
+					return false
+				}
+				statusProber.CancelIngressProbing(ing)
+				return true
+			}, ingressInformer.Informer())
+		},
+	})
+	// Load balancer addresses follow the status of the gateway services, and
+	// mirrored requests the mirror Services.
+	serviceInformer.Informer().AddEventHandler(controller.HandleAll(
+		controller.EnsureTypeMeta(
+			impl.Tracker.OnChanged,
+			corev1.SchemeGroupVersion.WithKind("Service"),
+		),
+	))
+
+	endpointSliceInformer.Informer().AddEventHandler(&endpointSliceHandler{
+		logger:          logger,
+		prober:          statusProber,
+		ingressLister:   ingressInformer.Lister(),
+		namespaceLister: namespaceInformer.Lister(),
+		gatewayConfig:   func() *config.Gateway { return configStore.Load().Gateway },
+		filterFunc:      filterFunc,
+		enqueue:         impl.Enqueue,
+	})
 
-	statusProber := status.NewProber(
-		logger.Named("status-manager"),
-		NewProbeTargetLister(logger, endpointsInformer.Lister()),
-		func(ing *v1alpha1.Ingress) {
-			logger.Debugf("Ready callback triggered for ingress: %s/%s", ing.Namespace, ing.Name)
-			impl.EnqueueKey(types.NamespacedName{Namespace: ing.Namespace, Name: ing.Name})
-		})
-	c.statusManager = statusProber
-	statusProber.Start(ctx.Done())
-
-	// Make sure trackers are deleted once the observers are removed.
+	// Make sure trackers are deleted and probing is stopped once the observers are removed.
 	ingressInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		DeleteFunc: impl.Tracker.OnDeletedObserver,
+		DeleteFunc: func(obj interface{}) {
+			impl.Tracker.OnDeletedObserver(obj)
+			statusProber.CancelIngressProbing(obj)
+		},
 	})
 
 	return impl
@@ -17,26 +17,36 @@ limitations under the License.
 package ingress
 
 import (
+	"context"
 	"testing"
 
 	_ "knative.dev/networking/pkg/client/injection/informers/networking/v1alpha1/ingress/fake"
-	_ "knative.dev/pkg/client/injection/kube/informers/core/v1/endpoints/fake"
+	_ "knative.dev/pkg/client/injection/kube/client/fake"
+	_ "knative.dev/pkg/client/injection/kube/informers/core/v1/namespace/fake"
+	_ "knative.dev/pkg/client/injection/kube/informers/core/v1/secret/filtered/fake"
+	_ "knative.dev/pkg/client/injection/kube/informers/core/v1/service/fake"
+	_ "knative.dev/pkg/client/injection/kube/informers/discovery/v1/endpointslice/fake"
+	_ "knative.dev/pkg/client/injection/kube/informers/factory/filtered/fake"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	network "knative.dev/networking/pkg"
+	filteredinformerfactory "knative.dev/pkg/client/injection/kube/informers/factory/filtered"
 	"knative.dev/pkg/configmap"
 	"knative.dev/pkg/system"
 
 	. "knative.dev/pkg/reconciler/testing"
 
 	_ "github.com/nak3/net-gateway-api/pkg/client/gatewayapi/injection/informers/apis/v1alpha1/gateway/fake"
+	_ "github.com/nak3/net-gateway-api/pkg/client/gatewayapi/injection/informers/apis/v1alpha1/gatewayclass/fake"
 	_ "github.com/nak3/net-gateway-api/pkg/client/gatewayapi/injection/informers/apis/v1alpha1/httproute/fake"
 	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/config"
 )
 
 func TestNew(t *testing.T) {
-	ctx, _ := SetupFakeContext(t)
+	ctx, _ := SetupFakeContext(t, func(ctx context.Context) context.Context {
+		return filteredinformerfactory.WithSelectors(ctx, SecretSelectors...)
+	})
 
 	c := NewController(ctx, configmap.NewStaticWatcher(&corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
@@ -54,3 +64,25 @@ func TestNew(t *testing.T) {
 		t.Fatal("Expected NewController to return a non-nil value")
 	}
 }
+
+func TestNewManagedGatewayController(t *testing.T) {
+	ctx, _ := SetupFakeContext(t, func(ctx context.Context) context.Context {
+		return filteredinformerfactory.WithSelectors(ctx, SecretSelectors...)
+	})
+
+	c := NewManagedGatewayController(ctx, configmap.NewStaticWatcher(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: system.Namespace(),
+			Name:      config.GatewayConfigName,
+		},
+	}, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: system.Namespace(),
+			Name:      network.ConfigName,
+		},
+	}))
+
+	if c == nil {
+		t.Fatal("Expected NewManagedGatewayController to return a non-nil value")
+	}
+}
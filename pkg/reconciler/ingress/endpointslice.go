@@ -0,0 +1,166 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingress
+
+import (
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"knative.dev/networking/pkg/apis/networking/v1alpha1"
+	networkinglisters "knative.dev/networking/pkg/client/listers/networking/v1alpha1"
+
+	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/config"
+)
+
+// podProber is the part of status.Prober which cancels the probing.
+type podProber interface {
+	CancelPodProbing(obj interface{})
+	CancelIngressProbing(obj interface{})
+}
+
+// endpointSliceHandler keeps the probing in sync with the pods of the gateway
+// services. The probing of the removed pods is cancelled, and the Ingresses
+// which are not ready yet are probed again with the current pods.
+type endpointSliceHandler struct {
+	logger          *zap.SugaredLogger
+	prober          podProber
+	ingressLister   networkinglisters.IngressLister
+	namespaceLister corev1listers.NamespaceLister
+	gatewayConfig   func() *config.Gateway
+	filterFunc      func(interface{}) bool
+	enqueue         func(interface{})
+}
+
+var _ cache.ResourceEventHandler = (*endpointSliceHandler)(nil)
+
+// OnAdd implements cache.ResourceEventHandler.
+func (h *endpointSliceHandler) OnAdd(obj interface{}) {
+	if slice := h.gatewaySlice(obj); slice != nil {
+		h.reprobe(slice)
+	}
+}
+
+// OnUpdate implements cache.ResourceEventHandler.
+func (h *endpointSliceHandler) OnUpdate(oldObj, newObj interface{}) {
+	oldSlice, newSlice := h.gatewaySlice(oldObj), h.gatewaySlice(newObj)
+	if newSlice == nil {
+		return
+	}
+	if oldSlice != nil {
+		// The resyncs and the changes of the slice which leave the ready
+		// pods alone do not reprobe anything.
+		oldReady, newReady := readyAddresses(oldSlice), readyAddresses(newSlice)
+		if oldReady.Equal(newReady) {
+			return
+		}
+		h.cancelPods(oldReady.Difference(newReady))
+	}
+	h.reprobe(newSlice)
+}
+
+// OnDelete implements cache.ResourceEventHandler.
+func (h *endpointSliceHandler) OnDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if slice := h.gatewaySlice(obj); slice != nil {
+		h.cancelPods(readyAddresses(slice))
+		h.reprobe(slice)
+	}
+}
+
+// gatewaySlice returns the EndpointSlice if it belongs to a gateway service
+// whose pods are probed, or nil otherwise.
+func (h *endpointSliceHandler) gatewaySlice(obj interface{}) *discoveryv1.EndpointSlice {
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		return nil
+	}
+	if len(h.visibilities(slice)) == 0 {
+		return nil
+	}
+	return slice
+}
+
+// visibilities returns the visibilities whose gateway service owns the slice
+// and whose readiness is verified by probing the pods.
+func (h *endpointSliceHandler) visibilities(slice *discoveryv1.EndpointSlice) sets.String {
+	gatewayConfig := h.gatewayConfig()
+	key := slice.Namespace + "/" + slice.Labels[discoveryv1.LabelServiceName]
+
+	visibilities := sets.NewString()
+	for _, visibility := range []v1alpha1.IngressVisibility{
+		v1alpha1.IngressVisibilityExternalIP,
+		v1alpha1.IngressVisibilityClusterLocal,
+	} {
+		if gatewayConfig.LookupReadiness(visibility) != config.ReadinessPodProbe {
+			continue
+		}
+		for _, svc := range gatewayConfig.LookupServices(visibility) {
+			if svc == key {
+				visibilities.Insert(string(visibility))
+			}
+		}
+	}
+	return visibilities
+}
+
+func (h *endpointSliceHandler) cancelPods(ips sets.String) {
+	for ip := range ips {
+		h.prober.CancelPodProbing(&corev1.Pod{Status: corev1.PodStatus{PodIP: ip}})
+	}
+}
+
+// reprobe cancels the probing of the Ingresses which are routed through the
+// gateway of the slice and are not ready yet, and enqueues them to be probed
+// with the current pods.
+func (h *endpointSliceHandler) reprobe(slice *discoveryv1.EndpointSlice) {
+	visibilities := h.visibilities(slice)
+	gatewayConfig := h.gatewayConfig()
+	key := slice.Namespace + "/" + slice.Labels[discoveryv1.LabelServiceName]
+
+	ings, err := h.ingressLister.List(labels.Everything())
+	if err != nil {
+		h.logger.Errorw("Failed to list Ingresses", zap.Error(err))
+		return
+	}
+	for _, ing := range ings {
+		if !h.filterFunc(ing) || ing.Status.GetCondition(v1alpha1.IngressConditionLoadBalancerReady).IsTrue() {
+			continue
+		}
+		for _, rule := range ing.Spec.Rules {
+			if !visibilities.Has(string(rule.Visibility)) {
+				continue
+			}
+			namespaceLabels, err := namespaceLabels(h.namespaceLister, ing.Namespace)
+			if err != nil {
+				h.logger.Errorw("Failed to get the namespace of Ingress", zap.Error(err))
+				return
+			}
+			if sets.NewString(gatewayConfig.LookupServicesFor(ing, namespaceLabels, rule.Visibility)...).Has(key) {
+				h.prober.CancelIngressProbing(ing)
+				h.enqueue(ing)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingress
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	"knative.dev/networking/pkg/apis/networking"
+	"knative.dev/networking/pkg/apis/networking/v1alpha1"
+	"knative.dev/pkg/reconciler"
+
+	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/config"
+	. "github.com/nak3/net-gateway-api/pkg/reconciler/testing"
+)
+
+func TestEndpointSliceHandler(t *testing.T) {
+	ingresses := []runtime.Object{
+		ing(withName("not-ready"), withBasicSpec, withGatewayAPIClass),
+		ing(withName("ready"), withBasicSpec, withGatewayAPIClass, withLoadBalancers(nil, nil)),
+		ing(withName("other-class"), withBasicSpec, withAnnotation(map[string]string{
+			networking.IngressClassAnnotationKey: "other",
+		})),
+		ing(withName("local"), withBasicSpec, withLocalOnly, withGatewayAPIClass),
+	}
+
+	tests := []struct {
+		name         string
+		readiness    config.ReadinessStrategy
+		do           func(*endpointSliceHandler)
+		wantCanceled []string
+		wantEnqueued []string
+	}{{
+		name: "pod is added",
+		do: func(h *endpointSliceHandler) {
+			h.OnAdd(public(privateEndpointsOneAddr))
+		},
+		wantCanceled: []string{"ingress:not-ready"},
+		wantEnqueued: []string{"not-ready"},
+	}, {
+		name: "pod is removed",
+		do: func(h *endpointSliceHandler) {
+			h.OnUpdate(public(privateEndpointsMultiAddr), public(endpointSlice(privateName+"-a",
+				discoveryv1.AddressTypeIPv4, endpoint("2.3.4.5", nil))))
+		},
+		wantCanceled: []string{"pod:3.4.5.6", "ingress:not-ready"},
+		wantEnqueued: []string{"not-ready"},
+	}, {
+		name: "ready pods are unchanged",
+		do: func(h *endpointSliceHandler) {
+			h.OnUpdate(public(privateEndpointsOneAddr), public(privateEndpointsOneAddr))
+		},
+	}, {
+		name: "slice is deleted",
+		do: func(h *endpointSliceHandler) {
+			h.OnDelete(cache.DeletedFinalStateUnknown{Obj: public(privateEndpointsOneAddr)})
+		},
+		wantCanceled: []string{"pod:1.2.3.4", "ingress:not-ready"},
+		wantEnqueued: []string{"not-ready"},
+	}, {
+		name: "slice of the local gateway",
+		do: func(h *endpointSliceHandler) {
+			h.OnAdd(privateEndpointsOneAddr)
+		},
+		wantCanceled: []string{"ingress:local"},
+		wantEnqueued: []string{"local"},
+	}, {
+		name: "slice of another service",
+		do: func(h *endpointSliceHandler) {
+			slice := endpointSlice("other", discoveryv1.AddressTypeIPv4, endpoint("1.2.3.4", nil))
+			slice.Labels[discoveryv1.LabelServiceName] = "other"
+			h.OnAdd(slice)
+		},
+	}, {
+		name:      "pods are not probed",
+		readiness: config.ReadinessConditions,
+		do: func(h *endpointSliceHandler) {
+			h.OnDelete(public(privateEndpointsOneAddr))
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tl := NewListers(ingresses)
+			prober := &fakeProber{}
+			var enqueued []string
+
+			cfg := defaultConfig.DeepCopy()
+			cfg.Gateway.Gateways[v1alpha1.IngressVisibilityExternalIP].Readiness = test.readiness
+			h := &endpointSliceHandler{
+				prober:          prober,
+				ingressLister:   tl.GetIngressLister(),
+				namespaceLister: tl.GetNamespaceLister(),
+				gatewayConfig:   func() *config.Gateway { return cfg.Gateway },
+				filterFunc:      reconciler.AnnotationFilterFunc(networking.IngressClassAnnotationKey, GatewayAPIIngressClassName, true),
+				enqueue: func(obj interface{}) {
+					enqueued = append(enqueued, obj.(*v1alpha1.Ingress).Name)
+				},
+			}
+
+			test.do(h)
+
+			if !cmp.Equal(test.wantCanceled, prober.canceled) {
+				t.Error("Canceled (-want, +got) =", cmp.Diff(test.wantCanceled, prober.canceled))
+			}
+			if !cmp.Equal(test.wantEnqueued, enqueued) {
+				t.Error("Enqueued (-want, +got) =", cmp.Diff(test.wantEnqueued, enqueued))
+			}
+		})
+	}
+}
+
+type fakeProber struct {
+	canceled []string
+}
+
+func (p *fakeProber) CancelPodProbing(obj interface{}) {
+	p.canceled = append(p.canceled, "pod:"+obj.(*corev1.Pod).Status.PodIP)
+}
+
+func (p *fakeProber) CancelIngressProbing(obj interface{}) {
+	p.canceled = append(p.canceled, "ingress:"+obj.(*v1alpha1.Ingress).Name)
+}
+
+func withLocalOnly(i *v1alpha1.Ingress) {
+	for j := range i.Spec.Rules {
+		i.Spec.Rules[j].Visibility = v1alpha1.IngressVisibilityClusterLocal
+	}
+}
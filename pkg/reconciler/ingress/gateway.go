@@ -0,0 +1,276 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingress
+
+import (
+	"context"
+	"fmt"
+
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	gatewayv1alpha1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
+
+	"knative.dev/networking/pkg/apis/networking/v1alpha1"
+
+	gwlisters "github.com/nak3/net-gateway-api/pkg/client/gatewayapi/listers/apis/v1alpha1"
+	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/config"
+	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/resources"
+)
+
+// getGateway returns the Gateway of the given namespace/name key, or nil if
+// the Gateway does not exist.
+func getGateway(lister gwlisters.GatewayLister, key string) (*gatewayv1alpha1.Gateway, error) {
+	if key == "" {
+		return nil, nil
+	}
+	ns, name, _ := cache.SplitMetaNamespaceKey(key)
+	gw, err := lister.Gateways(ns).Get(name)
+	if apierrs.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get Gateway %q: %w", key, err)
+	}
+	return gw, nil
+}
+
+// lookupGatewayAddresses returns the addresses reported by the Gateway, or by
+// the gateway service when the Gateway is nil or does not report any.
+func lookupGatewayAddresses(gw *gatewayv1alpha1.Gateway, serviceLister corev1listers.ServiceLister,
+	serviceKey string) ([]v1alpha1.LoadBalancerIngressStatus, error) {
+	var addresses []v1alpha1.LoadBalancerIngressStatus
+	if gw != nil {
+		for _, addr := range gw.Status.Addresses {
+			// NamedAddress is implementation specific and cannot be resolved.
+			if addr.Type == nil || *addr.Type == gatewayv1alpha1.IPAddressType {
+				addresses = append(addresses, v1alpha1.LoadBalancerIngressStatus{IP: addr.Value})
+			}
+		}
+		if len(addresses) > 0 {
+			return addresses, nil
+		}
+	}
+
+	ns, name, _ := cache.SplitMetaNamespaceKey(serviceKey)
+	svc, err := serviceLister.Services(ns).Get(name)
+	if apierrs.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get Service %q: %w", serviceKey, err)
+	}
+	for _, lb := range svc.Status.LoadBalancer.Ingress {
+		addresses = append(addresses, v1alpha1.LoadBalancerIngressStatus{IP: lb.IP, Domain: lb.Hostname})
+	}
+	return addresses, nil
+}
+
+// isGatewayReady returns true if the Gateway reports the Ready condition.
+func isGatewayReady(gw *gatewayv1alpha1.Gateway) bool {
+	return apimeta.IsStatusConditionTrue(gw.Status.Conditions, string(gatewayv1alpha1.GatewayConditionReady))
+}
+
+// validateGateway verifies that the Gateway of the visibility with the given
+// key exists, belongs to the configured GatewayClass which is admitted, and has
+// a listener which selects the HTTPRoute, and that the HTTPS listeners of its
+// TLS hosts are neither conflicted nor missing their certificates. Otherwise it
+// returns the reason and the message of the failure.
+func (c *Reconciler) validateGateway(ctx context.Context, ing *v1alpha1.Ingress,
+	visibility v1alpha1.IngressVisibility, key string, gw *gatewayv1alpha1.Gateway,
+	route *gatewayv1alpha1.HTTPRoute) (string, string, error) {
+	gatewayConfig := config.FromContext(ctx).Gateway
+
+	if gw == nil {
+		return "GatewayNotFound", fmt.Sprintf("Gateway %q does not exist.", key), nil
+	}
+
+	if class := gatewayConfig.LookupGatewayClass(visibility); class != "" {
+		if gw.Spec.GatewayClassName != class {
+			return "GatewayClassMismatch", fmt.Sprintf("Gateway %q belongs to GatewayClass %q instead of %q.",
+				key, gw.Spec.GatewayClassName, class), nil
+		}
+		gwc, err := c.gatewayClassLister.Get(class)
+		if apierrs.IsNotFound(err) {
+			return "GatewayClassNotFound", fmt.Sprintf("GatewayClass %q does not exist.", class), nil
+		} else if err != nil {
+			return "", "", fmt.Errorf("failed to get GatewayClass %q: %w", class, err)
+		}
+		cond := apimeta.FindStatusCondition(gwc.Status.Conditions, string(gatewayv1alpha1.GatewayClassConditionStatusAdmitted))
+		if cond == nil {
+			return "GatewayClassNotAdmitted", fmt.Sprintf("Waiting for GatewayClass %q to be admitted.", class), nil
+		}
+		if cond.Status != metav1.ConditionTrue {
+			return "GatewayClassNotAdmitted", fmt.Sprintf("GatewayClass %q is not admitted: %s: %s",
+				class, cond.Reason, cond.Message), nil
+		}
+	}
+
+	if reason, message := tlsListenerFailure(gw, ing, visibility, route); reason != "" {
+		return reason, message, nil
+	}
+
+	for i := range gw.Spec.Listeners {
+		selected, err := c.listenerSelects(gw, &gw.Spec.Listeners[i], route)
+		if err != nil {
+			return "", "", err
+		}
+		if selected {
+			return "", "", nil
+		}
+	}
+	return "NoMatchingListener", fmt.Sprintf("No listener of Gateway %q selects HTTPRoute %q.", key, route.Name), nil
+}
+
+// validateGateways verifies the Gateways of the visibility with validateGateway.
+// The first Gateway must serve the HTTPRoute, and the others as many as the
+// quorum of the visibility requires. Otherwise it marks the Ingress with the
+// reason of the first failure and returns false.
+func (c *Reconciler) validateGateways(ctx context.Context, ing *v1alpha1.Ingress,
+	visibility v1alpha1.IngressVisibility, keys []string, gateways []*gatewayv1alpha1.Gateway,
+	route *gatewayv1alpha1.HTTPRoute) (bool, error) {
+	var reason, message string
+	valid := 0
+	for i, gw := range gateways {
+		r, m, err := c.validateGateway(ctx, ing, visibility, keys[i], gw, route)
+		if err != nil {
+			return false, err
+		}
+		if r == "" {
+			valid++
+			continue
+		}
+		if reason == "" {
+			reason, message = r, m
+		}
+		if i == 0 {
+			break
+		}
+	}
+	if reason == "" || (valid > 0 && valid >= config.FromContext(ctx).Gateway.LookupQuorum(visibility)) {
+		return true, nil
+	}
+	ing.GetConditionSet().Manage(ing.GetStatus()).MarkFalse(v1alpha1.IngressConditionNetworkConfigured,
+		reason, "%s", message)
+	return false, nil
+}
+
+// namespaceLabels returns the labels of the namespace, or nil if it does not
+// exist.
+func namespaceLabels(lister corev1listers.NamespaceLister, name string) (map[string]string, error) {
+	ns, err := lister.Get(name)
+	if apierrs.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get Namespace %q: %w", name, err)
+	}
+	return ns.Labels, nil
+}
+
+// isGatewayAllowed verifies that the Gateway of the gateway annotation of the
+// Ingress is allowed by the visibility of a rule of the Ingress. Otherwise it
+// marks the Ingress with the reason and returns false.
+func (c *Reconciler) isGatewayAllowed(ctx context.Context, ing *v1alpha1.Ingress) bool {
+	ruleVisibilities := make([]v1alpha1.IngressVisibility, 0, len(ing.Spec.Rules))
+	for _, rule := range ing.Spec.Rules {
+		ruleVisibilities = append(ruleVisibilities, rule.Visibility)
+	}
+	if config.FromContext(ctx).Gateway.IsGatewayAllowed(ing, ruleVisibilities...) {
+		return true
+	}
+	ing.GetConditionSet().Manage(ing.GetStatus()).MarkFalse(v1alpha1.IngressConditionNetworkConfigured,
+		"GatewayNotAllowed", "Gateway %q of annotation %q is not allowed by config-gateway.",
+		ing.Annotations[config.GatewayAnnotationKey], config.GatewayAnnotationKey)
+	return false
+}
+
+// listenerSelects returns true if the listener of the Gateway selects the
+// HTTPRoute by its kind, labels and namespace.
+func (c *Reconciler) listenerSelects(gw *gatewayv1alpha1.Gateway, listener *gatewayv1alpha1.Listener,
+	route *gatewayv1alpha1.HTTPRoute) (bool, error) {
+	if listener.Protocol != gatewayv1alpha1.HTTPProtocolType && listener.Protocol != gatewayv1alpha1.HTTPSProtocolType {
+		return false, nil
+	}
+	routes := listener.Routes
+	if routes.Kind != "HTTPRoute" || (routes.Group != nil && *routes.Group != gatewayv1alpha1.GroupName) {
+		return false, nil
+	}
+	if routes.Selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(routes.Selector)
+		if err != nil || !selector.Matches(labels.Set(route.Labels)) {
+			return false, nil
+		}
+	}
+
+	from := gatewayv1alpha1.RouteSelectSame
+	if routes.Namespaces != nil && routes.Namespaces.From != nil {
+		from = *routes.Namespaces.From
+	}
+	switch from {
+	case gatewayv1alpha1.RouteSelectAll:
+		return true, nil
+	case gatewayv1alpha1.RouteSelectSelector:
+		selector, err := metav1.LabelSelectorAsSelector(routes.Namespaces.Selector)
+		if err != nil {
+			return false, nil
+		}
+		ns, err := c.namespaceLister.Get(route.Namespace)
+		if apierrs.IsNotFound(err) {
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("failed to get Namespace %q: %w", route.Namespace, err)
+		}
+		return selector.Matches(labels.Set(ns.Labels)), nil
+	default:
+		return route.Namespace == gw.Namespace, nil
+	}
+}
+
+// tlsListenerFailure returns the reason and the message when the status of an
+// HTTPS listener of the Gateway for a TLS host of the HTTPRoute reports that
+// the listener is conflicted or its references are not resolved.
+func tlsListenerFailure(gw *gatewayv1alpha1.Gateway, ing *v1alpha1.Ingress,
+	visibility v1alpha1.IngressVisibility, route *gatewayv1alpha1.HTTPRoute) (string, string) {
+	hosts := sets.NewString()
+	for i := range ing.Spec.TLS {
+		hosts.Insert(resources.TLSHosts(ing, &ing.Spec.TLS[i], visibility)...)
+	}
+	routeHosts := sets.NewString()
+	for _, h := range route.Spec.Hostnames {
+		routeHosts.Insert(string(h))
+	}
+	hosts = hosts.Intersection(routeHosts)
+
+	for _, l := range gw.Status.Listeners {
+		if l.Protocol != gatewayv1alpha1.HTTPSProtocolType || l.Hostname == nil || !hosts.Has(string(*l.Hostname)) {
+			continue
+		}
+		if cond := apimeta.FindStatusCondition(l.Conditions, string(gatewayv1alpha1.ListenerConditionConflicted)); cond != nil &&
+			cond.Status == metav1.ConditionTrue {
+			return "ListenerConflicted", fmt.Sprintf("Listener of Gateway %q for host %q is conflicted: %s: %s",
+				gw.Namespace+"/"+gw.Name, *l.Hostname, cond.Reason, cond.Message)
+		}
+		if cond := apimeta.FindStatusCondition(l.Conditions, string(gatewayv1alpha1.ListenerConditionResolvedRefs)); cond != nil &&
+			cond.Status == metav1.ConditionFalse {
+			return "ListenerRefsNotResolved", fmt.Sprintf("Listener of Gateway %q for host %q has unresolved references: %s: %s",
+				gw.Namespace+"/"+gw.Name, *l.Hostname, cond.Reason, cond.Message)
+		}
+	}
+	return "", ""
+}
@@ -18,24 +18,34 @@ package ingress
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"go.uber.org/zap"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	gatewayv1alpha1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
 
 	"knative.dev/networking/pkg/apis/networking/v1alpha1"
 	ingressreconciler "knative.dev/networking/pkg/client/injection/reconciler/networking/v1alpha1/ingress"
+	networkinglisters "knative.dev/networking/pkg/client/listers/networking/v1alpha1"
 	"knative.dev/networking/pkg/ingress"
 	"knative.dev/networking/pkg/status"
+	"knative.dev/pkg/apis"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/network"
 	pkgreconciler "knative.dev/pkg/reconciler"
+	"knative.dev/pkg/tracker"
 
 	gwapiclientset "github.com/nak3/net-gateway-api/pkg/client/gatewayapi/clientset/versioned"
 	gwlisters "github.com/nak3/net-gateway-api/pkg/client/gatewayapi/listers/apis/v1alpha1"
 	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/config"
+	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/resources"
 )
 
 const (
@@ -44,20 +54,48 @@ const (
 
 	// GatewayAPIIngressClassName is the class name to reconcile.
 	GatewayAPIIngressClassName = "gateway-api.ingress.networking.knative.dev"
+
+	// ConditionHTTPRedirectConfigured is set to false when the Ingress asks
+	// for the plain HTTP requests to be redirected to HTTPS, but no redirect
+	// filter is configured. It is informational and does not affect the
+	// readiness of the Ingress.
+	ConditionHTTPRedirectConfigured apis.ConditionType = "HTTPRedirectConfigured"
 )
 
 // Reconciler implements controller.Reconciler for Route resources.
 type Reconciler struct {
 	statusManager status.Manager
 
+	kubeclient  kubernetes.Interface
 	gwapiclient gwapiclientset.Interface
 
 	// Listers index properties about resources
-	httprouteLister gwlisters.HTTPRouteLister
+	ingressLister      networkinglisters.IngressLister
+	httprouteLister    gwlisters.HTTPRouteLister
+	gatewayLister      gwlisters.GatewayLister
+	gatewayClassLister gwlisters.GatewayClassLister
+	namespaceLister    corev1listers.NamespaceLister
+	secretLister       corev1listers.SecretLister
+	// certificateSecretLister lists the secrets of the Knative Certificates.
+	// The other origin TLS secrets are not cached.
+	certificateSecretLister corev1listers.SecretLister
+	serviceLister           corev1listers.ServiceLister
+
+	tracker tracker.Interface
 }
 
 var (
 	_ ingressreconciler.Interface = (*Reconciler)(nil)
+
+	// visibilities are the visibilities which have a Gateway.
+	visibilities = []v1alpha1.IngressVisibility{
+		v1alpha1.IngressVisibilityExternalIP,
+		v1alpha1.IngressVisibilityClusterLocal,
+	}
+
+	// errNotOwned is returned when a resource which the Ingress needs to
+	// manage already exists but is controlled by someone else.
+	errNotOwned = errors.New("resource is not owned by the Ingress")
 )
 
 // ReconcileKind implements Interface.ReconcileKind.
@@ -67,7 +105,10 @@ func (c *Reconciler) ReconcileKind(ctx context.Context, ingress *v1alpha1.Ingres
 	reconcileErr := c.reconcileIngress(ctx, ingress)
 	if reconcileErr != nil {
 		logger.Errorw("Failed to reconcile Ingress: ", zap.Error(reconcileErr))
-		ingress.Status.MarkIngressNotReady(notReconciledReason, notReconciledMessage)
+		// The ownership conflict has already been reported with its own reason.
+		if !errors.Is(reconcileErr, errNotOwned) {
+			ingress.Status.MarkIngressNotReady(notReconciledReason, notReconciledMessage)
+		}
 		return reconcileErr
 	}
 
@@ -92,45 +133,148 @@ func (c *Reconciler) reconcileIngress(ctx context.Context, ing *v1alpha1.Ingress
 
 	logger.Infof("Reconciling ingress: %#v", ing)
 
-	for _, rule := range ing.Spec.Rules {
-		rule := rule
+	// The gateway selectors match the labels of the Ingress namespace.
+	nsLabels, err := namespaceLabels(c.namespaceLister, ing.Namespace)
+	if err != nil {
+		return err
+	}
+	ctx = config.WithNamespaceLabels(ctx, nsLabels)
+
+	gatewayConfig := config.FromContext(ctx).Gateway
+	if !c.isGatewayAllowed(ctx, ing) {
+		return nil
+	}
+	if valid, err := c.isMirrorValid(ing); err != nil || !valid {
+		return err
+	}
+
+	if err := c.trackGateways(ctx, ing); err != nil {
+		return err
+	}
 
-		httproutes, err := c.reconcileHTTPRoute(ctx, ing, &rule)
+	// The gateways of each visibility are in the order of LookupGatewaysFor.
+	gateways := make(map[v1alpha1.IngressVisibility][]*gatewayv1alpha1.Gateway, 2)
+	for _, visibility := range visibilities {
+		// The managed Gateways are provisioned by their own work queue.
+		gw, err := getGateway(c.gatewayLister, gatewayConfig.LookupGateway(visibility))
 		if err != nil {
 			return err
 		}
+		if gw != nil && gatewayConfig.LookupManagedGateway(visibility) != nil && !isManaged(gw) {
+			// The Gateways applied by hand are never taken over.
+			return markNotOwned(ing, "Gateway", gw)
+		}
+		keys := gatewayConfig.LookupGatewaysFor(ing, nsLabels, visibility)
+		if len(keys) > 0 && keys[0] != gatewayConfig.LookupGateway(visibility) {
+			// The Ingress is routed through the Gateway of its annotation or
+			// of the selector matching it.
+			if gw, err = getGateway(c.gatewayLister, keys[0]); err != nil {
+				return err
+			}
+		}
+		gateways[visibility] = append(gateways[visibility], gw)
+		for _, key := range keys[1:] {
+			if gw, err = getGateway(c.gatewayLister, key); err != nil {
+				return err
+			}
+			gateways[visibility] = append(gateways[visibility], gw)
+		}
+	}
 
-		ready, err := IsHTTPRouteReady(httproutes)
+	desiredSecrets := sets.NewString()
+	for i := range ing.Spec.TLS {
+		tls := &ing.Spec.TLS[i]
+		if err := c.reconcileSecret(ctx, ing, tls); err != nil {
+			return err
+		}
+		desiredSecrets.Insert(resources.TLSSecretName(ing, tls))
+	}
+	if err := c.deleteStaleSecrets(ctx, ing, desiredSecrets); err != nil {
+		return err
+	}
+
+	desiredRoutes := sets.NewString()
+	// The HTTPRoutes named after the hosts by older versions are kept serving
+	// until the routes replacing them are ready.
+	legacyRoutes := sets.NewString()
+	var notReady []string
+	redirectMissing := false
+	for i := range ing.Spec.Rules {
+		rule := &ing.Spec.Rules[i]
+		legacyRoutes.Insert(resources.LegacyHTTPRouteName(rule.Hosts))
+
+		desired, err := resources.MakeHTTPRoute(ctx, ing, i)
 		if err != nil {
 			return err
 		}
+		httproutes := []*gatewayv1alpha1.HTTPRoute{desired}
+
+		if resources.IsHTTPRedirected(ing, rule) {
+			redirect, err := resources.MakeRedirectHTTPRoute(ctx, ing, i)
+			if err != nil {
+				return err
+			}
+			if redirect != nil {
+				httproutes = append(httproutes, redirect)
+			} else {
+				redirectMissing = true
+			}
+		}
 
-		if ready {
-			ing.Status.MarkNetworkConfigured()
-		} else {
-			ing.Status.MarkIngressNotReady("HTTPRouteNotReady", "Waiting for HTTPRoute becomes Ready.")
+		for j, route := range httproutes {
+			// Nothing is routed until the Gateways are able to serve the route.
+			keys := gatewayConfig.LookupGatewaysFor(ing, nsLabels, rule.Visibility)
+			if valid, err := c.validateGateways(ctx, ing, rule.Visibility, keys, gateways[rule.Visibility], route); err != nil || !valid {
+				return err
+			}
+
+			desiredRoutes.Insert(route.Name)
+			httproute, err := c.reconcileHTTPRoute(ctx, ing, route)
+			if err != nil {
+				return err
+			}
+			httproutes[j] = httproute
+
+			if ready, msg := IsHTTPRouteReady(httproute, gatewayConfig.LookupQuorum(rule.Visibility)); !ready {
+				notReady = append(notReady, msg)
+			}
 		}
 		logger.Infof("HTTPRoute successfully synced %v", httproutes)
 	}
 
+	if redirectMissing {
+		ing.GetConditionSet().Manage(ing.GetStatus()).MarkFalse(ConditionHTTPRedirectConfigured,
+			"HTTPRedirectNotConfigured", "No httpRedirect is configured in config-gateway, "+
+				"plain HTTP requests are served instead of redirected to HTTPS.")
+	} else if err := ing.GetConditionSet().Manage(ing.GetStatus()).ClearCondition(ConditionHTTPRedirectConfigured); err != nil {
+		return err
+	}
+
+	// The Ingress is configured only when the routes of all its rules are.
+	if len(notReady) == 0 {
+		ing.Status.MarkNetworkConfigured()
+	} else {
+		ing.Status.MarkIngressNotReady("HTTPRouteNotReady", strings.Join(notReady, " "))
+		desiredRoutes = desiredRoutes.Union(legacyRoutes)
+	}
+	if err := c.deleteStaleHTTPRoutes(ctx, ing, desiredRoutes); err != nil {
+		return err
+	}
+
 	ready, err := c.statusManager.IsReady(ctx, before)
 	if err != nil {
 		return fmt.Errorf("failed to probe Ingress: %w", err)
 	}
 
 	if ready {
-		gatewayConfig := config.FromContext(ctx).Gateway
-
-		ns, name, _ := cache.SplitMetaNamespaceKey(gatewayConfig.LookupService(v1alpha1.IngressVisibilityExternalIP))
-		publicLbs := []v1alpha1.LoadBalancerIngressStatus{
-			{DomainInternal: network.GetServiceHostname(name, ns)},
+		publicLbs, err := c.lookupLoadBalancers(ctx, ing, v1alpha1.IngressVisibilityExternalIP)
+		if err != nil {
+			return err
 		}
-
-		ns, name, _ = cache.SplitMetaNamespaceKey(gatewayConfig.LookupService(v1alpha1.IngressVisibilityClusterLocal))
-		privateLbs := []v1alpha1.LoadBalancerIngressStatus{
-			{DomainInternal: network.GetServiceHostname(name, ns)},
+		privateLbs, err := c.lookupLoadBalancers(ctx, ing, v1alpha1.IngressVisibilityClusterLocal)
+		if err != nil {
+			return err
 		}
-
 		ing.Status.MarkLoadBalancerReady(publicLbs, privateLbs)
 	} else {
 		ing.Status.MarkLoadBalancerNotReady()
@@ -139,26 +283,208 @@ func (c *Reconciler) reconcileIngress(ctx context.Context, ing *v1alpha1.Ingress
 	return nil
 }
 
-// IsHTTPRouteReady will check the status conditions of the ingress and return true if
-// all gateways have been admitted.
-func IsHTTPRouteReady(r *gatewayv1alpha1.HTTPRoute) (bool, error) {
-	if r.Status.Gateways == nil {
-		return false, nil
+// trackGateways tracks the Gateways and GatewayClasses of all visibilities, as
+// both the routing and the load balancers of the Ingress depend on them.
+func (c *Reconciler) trackGateways(ctx context.Context, ing *v1alpha1.Ingress) error {
+	gatewayConfig := config.FromContext(ctx).Gateway
+
+	for _, visibility := range visibilities {
+		for _, key := range gatewayConfig.LookupGatewaysFor(ing, config.NamespaceLabelsFromContext(ctx), visibility) {
+			ns, name, _ := cache.SplitMetaNamespaceKey(key)
+			if err := c.tracker.TrackReference(tracker.Reference{
+				APIVersion: gatewayv1alpha1.SchemeGroupVersion.String(),
+				Kind:       "Gateway",
+				Namespace:  ns,
+				Name:       name,
+			}, ing); err != nil {
+				return fmt.Errorf("failed to track Gateway %q: %w", key, err)
+			}
+		}
+		if class := gatewayConfig.LookupGatewayClass(visibility); class != "" {
+			if err := c.tracker.TrackReference(tracker.Reference{
+				APIVersion: gatewayv1alpha1.SchemeGroupVersion.String(),
+				Kind:       "GatewayClass",
+				Name:       class,
+			}, ing); err != nil {
+				return fmt.Errorf("failed to track GatewayClass %q: %w", class, err)
+			}
+		}
+	}
+	return nil
+}
+
+// lookupLoadBalancers returns the load balancers of the gateways for the given
+// visibility, in the order of LookupGatewaysFor. For each gateway the in-cluster
+// address of its service comes first, followed by the addresses reported by
+// the Gateway, or by the gateway service when the Gateway does not report any.
+// The cluster-local load balancer is the in-cluster address of the gateway of
+// the Ingress only: Serving builds the placeholder Services of the Routes from
+// it, and rejects more than one private load balancer. The additional gateways
+// which do not exist or are not Ready are not advertised.
+func (c *Reconciler) lookupLoadBalancers(ctx context.Context, ing *v1alpha1.Ingress,
+	visibility v1alpha1.IngressVisibility) ([]v1alpha1.LoadBalancerIngressStatus, error) {
+	gatewayConfig := config.FromContext(ctx).Gateway
+	namespaceLabels := config.NamespaceLabelsFromContext(ctx)
+
+	services := gatewayConfig.LookupServicesFor(ing, namespaceLabels, visibility)
+	keys := gatewayConfig.LookupGatewaysFor(ing, namespaceLabels, visibility)
+	private := visibility == v1alpha1.IngressVisibilityClusterLocal
+	if private && len(keys) > 1 {
+		keys = keys[:1]
+	}
+	var lbs []v1alpha1.LoadBalancerIngressStatus
+	for i, gwKey := range keys {
+		svcKey := services[i]
+		svcNamespace, svcName, _ := cache.SplitMetaNamespaceKey(svcKey)
+		if err := c.tracker.TrackReference(tracker.Reference{
+			APIVersion: "v1",
+			Kind:       "Service",
+			Namespace:  svcNamespace,
+			Name:       svcName,
+		}, ing); err != nil {
+			return nil, fmt.Errorf("failed to track Service %q: %w", svcKey, err)
+		}
+
+		gw, err := getGateway(c.gatewayLister, gwKey)
+		if err != nil {
+			return nil, err
+		}
+		// The additional gateways may be missing within the quorum.
+		if i > 0 && (gw == nil || !isGatewayReady(gw)) {
+			continue
+		}
+
+		lbs = append(lbs, v1alpha1.LoadBalancerIngressStatus{
+			DomainInternal: network.GetServiceHostname(svcName, svcNamespace),
+		})
+		if private {
+			continue
+		}
+
+		addresses, err := lookupGatewayAddresses(gw, c.serviceLister, svcKey)
+		if err != nil {
+			return nil, err
+		}
+		lbs = append(lbs, addresses...)
+	}
+	return lbs, nil
+}
+
+// IsHTTPRouteReady checks the status conditions of the HTTPRoute and returns
+// true if the quorum of its gateways have admitted it. A quorum of zero
+// requires all of them. Otherwise the returned message names the first gateway
+// which has not admitted the route yet and why.
+func IsHTTPRouteReady(r *gatewayv1alpha1.HTTPRoute, quorum int) (bool, string) {
+	if len(r.Status.Gateways) == 0 {
+		return false, fmt.Sprintf("Waiting for HTTPRoute %q to be admitted by its Gateways.", r.Name)
+	}
+
+	// The gateways referred by the route must have reported the status, and
+	// the route is verified by the gateways which report it otherwise.
+	var refs []gatewayv1alpha1.GatewayReference
+	if r.Spec.Gateways != nil {
+		refs = r.Spec.Gateways.GatewayRefs
 	}
-	for _, gw := range r.Status.Gateways {
-		if !isGatewayAdmitted(gw) {
-			// Return false if _any_ of the gateways isn't admitted yet.
-			return false, nil
+	if len(refs) == 0 {
+		for _, gw := range r.Status.Gateways {
+			refs = append(refs, gatewayv1alpha1.GatewayReference{
+				Namespace: gw.GatewayRef.Namespace,
+				Name:      gw.GatewayRef.Name,
+			})
 		}
 	}
-	return true, nil
+	if quorum <= 0 || quorum > len(refs) {
+		quorum = len(refs)
+	}
+
+	admitted := 0
+	msg := ""
+	for _, ref := range refs {
+		gwKey := ref.Namespace + "/" + ref.Name
+		var cond *metav1.Condition
+		if gw := findGatewayStatus(r.Status.Gateways, ref); gw != nil {
+			cond = admittedCondition(*gw)
+		}
+		switch {
+		case cond != nil && cond.Status == metav1.ConditionTrue:
+			admitted++
+		case msg != "":
+		case cond == nil:
+			msg = fmt.Sprintf("Waiting for Gateway %q to admit HTTPRoute %q.", gwKey, r.Name)
+		default:
+			msg = fmt.Sprintf("HTTPRoute %q is not admitted by Gateway %q: %s: %s",
+				r.Name, gwKey, cond.Reason, cond.Message)
+		}
+	}
+	if admitted >= quorum {
+		return true, ""
+	}
+	return false, msg
 }
 
-func isGatewayAdmitted(gw gatewayv1alpha1.RouteGatewayStatus) bool {
-	for _, condition := range gw.Conditions {
-		if condition.Type == string(gatewayv1alpha1.ConditionRouteAdmitted) {
-			return condition.Status == metav1.ConditionTrue
+func findGatewayStatus(statuses []gatewayv1alpha1.RouteGatewayStatus,
+	ref gatewayv1alpha1.GatewayReference) *gatewayv1alpha1.RouteGatewayStatus {
+	for i := range statuses {
+		if statuses[i].GatewayRef.Namespace == ref.Namespace && statuses[i].GatewayRef.Name == ref.Name {
+			return &statuses[i]
 		}
 	}
-	return false
+	return nil
+}
+
+func admittedCondition(gw gatewayv1alpha1.RouteGatewayStatus) *metav1.Condition {
+	for i := range gw.Conditions {
+		if gw.Conditions[i].Type == string(gatewayv1alpha1.ConditionRouteAdmitted) {
+			return &gw.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// markNotOwned marks the Ingress as not configured because the resource of the
+// given kind already exists and is controlled by someone else, and returns the
+// error to stop the reconciliation.
+func markNotOwned(ing *v1alpha1.Ingress, kind string, obj metav1.Object) error {
+	owner := "nobody"
+	if ref := metav1.GetControllerOf(obj); ref != nil {
+		owner = fmt.Sprintf("%s %q", ref.Kind, ref.Name)
+	}
+	ing.GetConditionSet().Manage(ing.GetStatus()).MarkFalse(v1alpha1.IngressConditionNetworkConfigured,
+		kind+"NotOwned", "There is an existing %s %q controlled by %s.", kind, obj.GetName(), owner)
+	return fmt.Errorf("ingress %q does not own %s %q: %w", ing.Name, kind, obj.GetName(), errNotOwned)
+}
+
+// isMirrorValid verifies the mirror annotation of the Ingress and that its
+// Service exists in the namespace of the Ingress, which is tracked to route the
+// Ingress once the Service appears. Otherwise it marks the Ingress with the
+// reason and returns false.
+func (c *Reconciler) isMirrorValid(ing *v1alpha1.Ingress) (bool, error) {
+	markFalse := func(messageFormat string, messageA ...interface{}) (bool, error) {
+		ing.GetConditionSet().Manage(ing.GetStatus()).MarkFalse(v1alpha1.IngressConditionNetworkConfigured,
+			"InvalidMirror", messageFormat, messageA...)
+		return false, nil
+	}
+
+	mirror, err := resources.MakeRequestMirror(ing)
+	if err != nil {
+		return markFalse("Failed to parse the mirror annotation: %v.", err)
+	}
+	if mirror == nil {
+		return true, nil
+	}
+
+	if err := c.tracker.TrackReference(tracker.Reference{
+		APIVersion: "v1",
+		Kind:       "Service",
+		Namespace:  ing.Namespace,
+		Name:       *mirror.ServiceName,
+	}, ing); err != nil {
+		return false, err
+	}
+	if _, err := c.serviceLister.Services(ing.Namespace).Get(*mirror.ServiceName); apierrs.IsNotFound(err) {
+		return markFalse("Mirror Service %q does not exist.", *mirror.ServiceName)
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get mirror Service %q: %w", *mirror.ServiceName, err)
+	}
+	return true, nil
 }
@@ -18,44 +18,1109 @@ package ingress
 
 import (
 	"context"
-	"errors"
+	"reflect"
 	"testing"
 
-	network "knative.dev/networking/pkg"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgotesting "k8s.io/client-go/testing"
+	gatewayv1alpha1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
 
+	network "knative.dev/networking/pkg"
 	"knative.dev/networking/pkg/apis/networking/v1alpha1"
 	fakeingressclient "knative.dev/networking/pkg/client/injection/client/fake"
 	ingressreconciler "knative.dev/networking/pkg/client/injection/reconciler/networking/v1alpha1/ingress"
+	"knative.dev/networking/pkg/ingress"
+	fakekubeclient "knative.dev/pkg/client/injection/kube/client/fake"
 	"knative.dev/pkg/configmap"
 	"knative.dev/pkg/controller"
+	"knative.dev/pkg/kmeta"
 	"knative.dev/pkg/logging"
+	"knative.dev/pkg/tracker"
 
 	. "github.com/nak3/net-gateway-api/pkg/reconciler/testing"
 	. "knative.dev/pkg/reconciler/testing"
 
 	fakegwapiclientset "github.com/nak3/net-gateway-api/pkg/client/gatewayapi/injection/client/fake"
 	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/config"
+	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/resources"
 )
 
 func TestReconcile(t *testing.T) {
-	theError := errors.New("this is the error")
-
 	table := TableTest{{
 		Name: "bad workqueue key",
 		Key:  "too/many/parts",
 	}, {
 		Name: "key not found",
 		Key:  "foo/not-found",
+	}, {
+		Name: "first reconcile creates HTTPRoute",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+		),
+		WantCreates: []runtime.Object{
+			httpRoute(t, ing(withBasicSpec, withGatewayAPIClass)),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withHTTPRouteNotReady),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeNormal, "Created", "Created HTTPRoute %q", "name-external-0"),
+		},
+	}, {
+		Name: "stale HTTPRoute is deleted",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+			httpRoute(t, ing(withBasicSpec, withGatewayAPIClass)),
+			httpRouteOwnedBy("removed.example.com", ing(withBasicSpec, withGatewayAPIClass)),
+		),
+		WantDeletes: []clientgotesting.DeleteActionImpl{{
+			ActionImpl: clientgotesting.ActionImpl{
+				Namespace: "ns",
+				Verb:      "delete",
+				Resource:  gatewayv1alpha1.SchemeGroupVersion.WithResource("httproutes"),
+			},
+			Name: "removed.example.com",
+		}},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withHTTPRouteNotReady),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeNormal, "Deleted", "Deleted HTTPRoute %q", "removed.example.com"),
+		},
+	}, {
+		Name: "HTTPRoute of another Ingress is kept",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+			httpRoute(t, ing(withBasicSpec, withGatewayAPIClass)),
+			httpRouteOwnedBy("other.example.com", ing(withBasicSpec, withGatewayAPIClass, withName("other"))),
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withHTTPRouteNotReady),
+		}},
+	}, {
+		Name: "legacy HTTPRoute is kept until its replacement is ready",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+			httpRouteOwnedBy("example.com", ing(withBasicSpec, withGatewayAPIClass)),
+		),
+		WantCreates: []runtime.Object{
+			httpRoute(t, ing(withBasicSpec, withGatewayAPIClass)),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withHTTPRouteNotReady),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeNormal, "Created", "Created HTTPRoute %q", "name-external-0"),
+		},
+	}, {
+		Name: "legacy HTTPRoute is deleted once its replacement is ready",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+			withAdmitted(httpRoute(t, ing(withBasicSpec, withGatewayAPIClass))),
+			httpRouteOwnedBy("example.com", ing(withBasicSpec, withGatewayAPIClass)),
+		),
+		WantDeletes: []clientgotesting.DeleteActionImpl{{
+			ActionImpl: clientgotesting.ActionImpl{
+				Namespace: "ns",
+				Verb:      "delete",
+				Resource:  gatewayv1alpha1.SchemeGroupVersion.WithResource("httproutes"),
+			},
+			Name: "example.com",
+		}},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withNetworkConfigured),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeNormal, "Deleted", "Deleted HTTPRoute %q", "example.com"),
+		},
+	}, {
+		Name: "readiness is aggregated over all rules",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withLocalRule, withGatewayAPIClass),
+			httpRoute(t, ing(withBasicSpec, withLocalRule, withGatewayAPIClass)),
+			withAdmitted(httpRouteAt(t, ing(withBasicSpec, withLocalRule, withGatewayAPIClass), 1)),
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withLocalRule, withGatewayAPIClass,
+				withHTTPRoutesNotReady(`Waiting for HTTPRoute "name-external-0" to be admitted by its Gateways.`)),
+		}},
+	}, {
+		Name: "Gateway does not exist",
+		Key:  "ns/name",
+		Objects: []runtime.Object{
+			ing(withBasicSpec, withGatewayAPIClass),
+			gatewayClass("istio", withGatewayClassAdmitted(metav1.ConditionTrue)),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withGatewayInvalid("GatewayNotFound",
+				`Gateway "istio-system/knative-gateway" does not exist.`)),
+		}},
+	}, {
+		Name: "Gateway belongs to another GatewayClass",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+			gateway("knative-gateway", func(gw *gatewayv1alpha1.Gateway) {
+				gw.Spec.GatewayClassName = "other"
+			}),
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withGatewayInvalid("GatewayClassMismatch",
+				`Gateway "istio-system/knative-gateway" belongs to GatewayClass "other" instead of "istio".`)),
+		}},
+	}, {
+		Name: "GatewayClass is not admitted",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+			gatewayClass("istio", withGatewayClassAdmitted(metav1.ConditionFalse)),
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withGatewayInvalid("GatewayClassNotAdmitted",
+				`GatewayClass "istio" is not admitted: Test: test`)),
+		}},
+	}, {
+		Name: "no listener selects the HTTPRoute",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+			gateway("knative-gateway", func(gw *gatewayv1alpha1.Gateway) {
+				gw.Spec.Listeners[0].Routes.Selector = &metav1.LabelSelector{
+					MatchLabels: map[string]string{"networking.knative.dev/visibility": "cluster-local"},
+				}
+			}),
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withGatewayInvalid("NoMatchingListener",
+				`No listener of Gateway "istio-system/knative-gateway" selects HTTPRoute "name-external-0".`)),
+		}},
+	}, {
+		Name: "listener selects the namespace of the HTTPRoute",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+			gateway("knative-gateway", func(gw *gatewayv1alpha1.Gateway) {
+				from := gatewayv1alpha1.RouteSelectSelector
+				gw.Spec.Listeners[0].Routes.Namespaces = &gatewayv1alpha1.RouteNamespaces{
+					From: &from,
+					Selector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"team": "a"},
+					},
+				}
+			}),
+			&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "ns",
+					Labels: map[string]string{"team": "a"},
+				},
+			},
+		),
+		WantCreates: []runtime.Object{
+			httpRoute(t, ing(withBasicSpec, withGatewayAPIClass)),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withHTTPRouteNotReady),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeNormal, "Created", "Created HTTPRoute %q", "name-external-0"),
+		},
+	}, {
+		Name: "plain HTTP requests are served without redirect filter",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass, withHTTPOption(v1alpha1.HTTPOptionRedirected)),
+		),
+		WantCreates: []runtime.Object{
+			httpRoute(t, ing(withBasicSpec, withGatewayAPIClass, withHTTPOption(v1alpha1.HTTPOptionRedirected))),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withHTTPOption(v1alpha1.HTTPOptionRedirected),
+				withHTTPRouteNotReady, withHTTPRedirectNotConfigured),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeNormal, "Created", "Created HTTPRoute %q", "name-external-0"),
+		},
+	}, {
+		Name: "ACME challenges are served over plain HTTP without redirect filter",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass, withHTTPOption(v1alpha1.HTTPOptionRedirected), withACMEChallenge),
+		),
+		WantCreates: []runtime.Object{
+			httpRoute(t, ing(withBasicSpec, withGatewayAPIClass, withHTTPOption(v1alpha1.HTTPOptionRedirected), withACMEChallenge)),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withHTTPOption(v1alpha1.HTTPOptionRedirected), withACMEChallenge,
+				withHTTPRouteNotReady, withHTTPRedirectNotConfigured),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeNormal, "Created", "Created HTTPRoute %q", "name-external-0"),
+		},
+	}, {
+		Name:    "HTTPRoute controlled by another Ingress",
+		Key:     "ns/name",
+		WantErr: true,
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+			httpRouteOwnedBy("name-external-0", ing(withBasicSpec, withGatewayAPIClass, withName("other"))),
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withHTTPRouteNotOwned("name-external-0", "other")),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeWarning, "InternalError", `ingress "name" does not own HTTPRoute "name-external-0": resource is not owned by the Ingress`),
+		},
+	}, {
+		Name: "requests mirrored to the Service of the annotation",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass, withMirrorAnnotation("shadow:80")),
+			service("shadow", withServiceNamespace("ns")),
+		),
+		WantCreates: []runtime.Object{
+			httpRoute(t, ing(withBasicSpec, withGatewayAPIClass, withMirrorAnnotation("shadow:80"))),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withMirrorAnnotation("shadow:80"), withHTTPRouteNotReady),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeNormal, "Created", "Created HTTPRoute %q", "name-external-0"),
+		},
+	}, {
+		Name: "mirror Service does not exist",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass, withMirrorAnnotation("shadow:80")),
+			service("shadow", withServiceNamespace("other")),
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withMirrorAnnotation("shadow:80"),
+				withGatewayInvalid("InvalidMirror", `Mirror Service "shadow" does not exist.`)),
+		}},
+	}, {
+		Name: "host rewritten through the Host header without host rewrite filter",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass, withRewriteHost("foo.com")),
+		),
+		WantCreates: []runtime.Object{
+			httpRoute(t, ing(withBasicSpec, withGatewayAPIClass, withRewriteHost("foo.com"))),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withRewriteHost("foo.com"), withHTTPRouteNotReady),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeNormal, "Created", "Created HTTPRoute %q", "name-external-0"),
+		},
+	}, {
+		Name: "invalid mirror annotation",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass, withMirrorAnnotation("shadow:http")),
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withMirrorAnnotation("shadow:http"),
+				withGatewayInvalid("InvalidMirror", `Failed to parse the mirror annotation: annotation `+
+					`"gateway-api.networking.knative.dev/mirror" has an invalid port: "shadow:http".`)),
+		}},
+	}}
+
+	table.Test(t, makeFactory(false))
+}
+
+func TestReconcileLoadBalancers(t *testing.T) {
+	publicService := "istio-ingressgateway.istio-system.svc.cluster.local"
+	privateService := "knative-local-gateway.istio-system.svc.cluster.local"
+
+	table := TableTest{{
+		Name: "addresses of the Gateway",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+			withAdmitted(httpRoute(t, ing(withBasicSpec, withGatewayAPIClass))),
+			gateway("knative-gateway", withGatewayAddress("1.2.3.4"), withGatewayAddress("5.6.7.8")),
+			service("istio-ingressgateway", withLoadBalancerHostname("lb.example.com")),
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withLoadBalancers(
+				[]v1alpha1.LoadBalancerIngressStatus{
+					{DomainInternal: publicService},
+					{IP: "1.2.3.4"},
+					{IP: "5.6.7.8"},
+				},
+				[]v1alpha1.LoadBalancerIngressStatus{{DomainInternal: privateService}},
+			)),
+		}},
+	}, {
+		Name: "fall back to the Service without Gateway addresses",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+			withAdmitted(httpRoute(t, ing(withBasicSpec, withGatewayAPIClass))),
+			gateway("knative-gateway"),
+			service("istio-ingressgateway", withLoadBalancerHostname("lb.example.com")),
+			service("knative-local-gateway"),
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withLoadBalancers(
+				[]v1alpha1.LoadBalancerIngressStatus{
+					{DomainInternal: publicService},
+					{Domain: "lb.example.com"},
+				},
+				[]v1alpha1.LoadBalancerIngressStatus{{DomainInternal: privateService}},
+			)),
+		}},
+	}, {
+		Name: "cluster-local load balancer is the in-cluster address only",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+			withAdmitted(httpRoute(t, ing(withBasicSpec, withGatewayAPIClass))),
+			gateway("knative-local-gateway", withGatewayAddress("10.0.0.1")),
+			service("knative-local-gateway", withLoadBalancerHostname("local.example.com")),
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withLoadBalancers(
+				[]v1alpha1.LoadBalancerIngressStatus{{DomainInternal: publicService}},
+				[]v1alpha1.LoadBalancerIngressStatus{{DomainInternal: privateService}},
+			)),
+		}},
+	}, {
+		Name: "in-cluster addresses only",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+			withAdmitted(httpRoute(t, ing(withBasicSpec, withGatewayAPIClass))),
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withLoadBalancers(
+				[]v1alpha1.LoadBalancerIngressStatus{{DomainInternal: publicService}},
+				[]v1alpha1.LoadBalancerIngressStatus{{DomainInternal: privateService}},
+			)),
+		}},
+	}}
+
+	table.Test(t, makeFactory(true))
+}
+
+func TestReconcileManagedGateway(t *testing.T) {
+	managedConfig := defaultConfig.DeepCopy()
+	managedConfig.Gateway.Gateways[v1alpha1.IngressVisibilityExternalIP].Managed = &config.ManagedGateway{}
+	ctx := (&testConfigStore{config: managedConfig}).ToContext(context.Background())
+	managed := resources.MakeGateway(ctx, v1alpha1.IngressVisibilityExternalIP, nil)
+	managedWithTLS := resources.MakeGateway(ctx, v1alpha1.IngressVisibilityExternalIP,
+		[]*v1alpha1.Ingress{ing(withBasicSpec, withTLS("cert"))})
+	certCopy := resources.GatewayTLSSecretName(ing(), &v1alpha1.IngressTLS{SecretName: "cert"})
+
+	table := TableTest{{
+		Name: "managed Gateway is not provisioned yet",
+		Key:  "ns/name",
+		Objects: []runtime.Object{
+			ing(withBasicSpec, withGatewayAPIClass),
+			gateway("knative-local-gateway"),
+			gatewayClass("istio", withGatewayClassAdmitted(metav1.ConditionTrue)),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withGatewayInvalid("GatewayNotFound",
+				`Gateway "istio-system/knative-gateway" does not exist.`)),
+		}},
+	}, {
+		Name: "managed Gateway is used as is",
+		Key:  "ns/name",
+		Objects: []runtime.Object{
+			ing(withBasicSpec, withGatewayAPIClass, withTLS("cert")),
+			tlsSecret("ns", "cert"),
+			managed,
+			gateway("knative-local-gateway"),
+			gatewayClass("istio", withGatewayClassAdmitted(metav1.ConditionTrue)),
+		},
+		WantCreates: []runtime.Object{
+			httpRoute(t, ing(withBasicSpec, withGatewayAPIClass, withTLS("cert"))),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withTLS("cert"), withHTTPRouteNotReady),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeNormal, "Created", "Created HTTPRoute %q", "name-external-0"),
+		},
+	}, {
+		Name: "Gateway applied by hand is not taken over",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, func(i *v1alpha1.Ingress) {
+				i.Status.InitializeConditions()
+				i.GetConditionSet().Manage(i.GetStatus()).MarkFalse(v1alpha1.IngressConditionNetworkConfigured,
+					"GatewayNotOwned", "There is an existing Gateway %q controlled by nobody.", "knative-gateway")
+			}),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeWarning, "InternalError", `ingress "name" does not own Gateway "knative-gateway": resource is not owned by the Ingress`),
+		},
+		WantErr: true,
+	}, {
+		Name: "conflicted TLS listener",
+		Key:  "ns/name",
+		Objects: []runtime.Object{
+			ing(withBasicSpec, withGatewayAPIClass, withTLS("cert")),
+			tlsSecret("ns", "cert"),
+			resources.MakeGatewaySecret(managedWithTLS, certCopy, tlsSecret("ns", "cert")),
+			withListenerStatus(managedWithTLS.DeepCopy(), "example.com", metav1.Condition{
+				Type:    string(gatewayv1alpha1.ListenerConditionConflicted),
+				Status:  metav1.ConditionTrue,
+				Reason:  string(gatewayv1alpha1.ListenerReasonHostnameConflict),
+				Message: "boom",
+			}),
+			gateway("knative-local-gateway"),
+			gatewayClass("istio", withGatewayClassAdmitted(metav1.ConditionTrue)),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withTLS("cert"), withGatewayInvalid("ListenerConflicted",
+				`Listener of Gateway "istio-system/knative-gateway" for host "example.com" is conflicted: HostnameConflict: boom`)),
+		}},
 	}}
 
-	table.Test(t, MakeFactory(func(ctx context.Context, listers *Listers, cmw configmap.Watcher) controller.Reconciler {
+	table.Test(t, makeFactoryWithConfig(false, managedConfig))
+}
+
+func TestReconcileManagedGateways(t *testing.T) {
+	managedConfig := defaultConfig.DeepCopy()
+	managedConfig.Gateway.Gateways[v1alpha1.IngressVisibilityExternalIP].Managed = &config.ManagedGateway{}
+	configCtx := (&testConfigStore{config: managedConfig}).ToContext(context.Background())
+	managed := resources.MakeGateway(configCtx, v1alpha1.IngressVisibilityExternalIP, nil)
+	managedWithTLS := resources.MakeGateway(configCtx, v1alpha1.IngressVisibilityExternalIP,
+		[]*v1alpha1.Ingress{ing(withBasicSpec, withTLS("cert"))})
+	certCopy := resources.MakeGatewaySecret(managedWithTLS,
+		resources.GatewayTLSSecretName(ing(), &v1alpha1.IngressTLS{SecretName: "cert"}), tlsSecret("ns", "cert"))
+	byHand := gateway("knative-gateway")
+
+	for _, tc := range []struct {
+		name        string
+		objects     []runtime.Object
+		wantGateway *gatewayv1alpha1.Gateway
+		wantSecret  bool
+	}{{
+		name:        "managed Gateway is created",
+		objects:     []runtime.Object{ing(withBasicSpec, withGatewayAPIClass)},
+		wantGateway: managed,
+	}, {
+		name: "TLS listener and its secret are created",
+		objects: []runtime.Object{tlsSecret("ns", "cert"),
+			ing(withBasicSpec, withGatewayAPIClass, withTLS("cert"))},
+		wantGateway: managedWithTLS,
+		wantSecret:  true,
+	}, {
+		name: "TLS listener and its secret are added",
+		objects: []runtime.Object{managed, tlsSecret("ns", "cert"),
+			ing(withBasicSpec, withGatewayAPIClass, withTLS("cert"))},
+		wantGateway: managedWithTLS,
+		wantSecret:  true,
+	}, {
+		name:        "listener of the last TLS Ingress is dropped",
+		objects:     []runtime.Object{managedWithTLS, certCopy},
+		wantGateway: managed,
+	}, {
+		name: "listener of a remaining TLS Ingress is kept",
+		objects: []runtime.Object{managedWithTLS, certCopy, tlsSecret("ns", "cert"),
+			ing(withBasicSpec, withGatewayAPIClass, withName("other"), withTLS("cert"))},
+		wantGateway: managedWithTLS,
+		wantSecret:  true,
+	}, {
+		name: "Gateway applied by hand is not taken over",
+		objects: []runtime.Object{byHand, tlsSecret("ns", "cert"),
+			ing(withBasicSpec, withGatewayAPIClass, withTLS("cert"))},
+		wantGateway: byHand,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			listers := NewListers(tc.objects)
+			ctx, kubeclient := fakekubeclient.With(context.Background(), listers.GetKubeObjects()...)
+			// The fake tracker guesses the resource of the Gateways wrong,
+			// so they are created through the client.
+			ctx, gwapiclient := fakegwapiclientset.With(ctx)
+			for _, obj := range listers.GetGatewayAPIObjects() {
+				if _, err := gwapiclient.NetworkingV1alpha1().Gateways(managed.Namespace).Create(
+					ctx, obj.(*gatewayv1alpha1.Gateway), metav1.CreateOptions{}); err != nil {
+					t.Fatal("Failed to create Gateway:", err)
+				}
+			}
+			r := &Reconciler{
+				kubeclient:              kubeclient,
+				gwapiclient:             gwapiclient,
+				ingressLister:           listers.GetIngressLister(),
+				gatewayLister:           listers.GetGatewayLister(),
+				namespaceLister:         listers.GetNamespaceLister(),
+				secretLister:            listers.GetSecretLister(),
+				certificateSecretLister: listers.GetSecretLister(),
+			}
+
+			if err := r.reconcileManagedGateways(config.ToContext(ctx, managedConfig)); err != nil {
+				t.Fatal("reconcileManagedGateways() =", err)
+			}
+
+			got, err := gwapiclient.NetworkingV1alpha1().Gateways(managed.Namespace).Get(ctx, managed.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal("Failed to get Gateway:", err)
+			}
+			if diff := cmp.Diff(tc.wantGateway.Spec, got.Spec); diff != "" {
+				t.Error("Unexpected Gateway spec (-want, +got):", diff)
+			}
+			_, err = kubeclient.CoreV1().Secrets(certCopy.Namespace).Get(ctx, certCopy.Name, metav1.GetOptions{})
+			if exists := err == nil; exists != tc.wantSecret {
+				t.Errorf("Secret %q exists = %v, want %v", certCopy.Name, exists, tc.wantSecret)
+			}
+		})
+	}
+}
+
+func TestReconcileHTTPRedirect(t *testing.T) {
+	redirectConfig := defaultConfig.DeepCopy()
+	redirectConfig.Gateway.Gateways[v1alpha1.IngressVisibilityExternalIP].HTTPRedirect = &gatewayv1alpha1.LocalObjectReference{
+		Group: "example.com",
+		Kind:  "Redirect",
+		Name:  "https",
+	}
+	redirected := withHTTPOption(v1alpha1.HTTPOptionRedirected)
+
+	table := TableTest{{
+		Name: "plain HTTP requests are redirected by their own route",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass, redirected),
+		),
+		WantCreates: []runtime.Object{
+			routeWithConfig(t, redirectConfig, ing(withBasicSpec, withGatewayAPIClass, redirected), resources.MakeHTTPRoute),
+			routeWithConfig(t, redirectConfig, ing(withBasicSpec, withGatewayAPIClass, redirected), resources.MakeRedirectHTTPRoute),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, redirected, withHTTPRoutesNotReady(
+				`Waiting for HTTPRoute "name-external-0" to be admitted by its Gateways. `+
+					`Waiting for HTTPRoute "name-external-0-redirect" to be admitted by its Gateways.`)),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeNormal, "Created", "Created HTTPRoute %q", "name-external-0"),
+			Eventf(corev1.EventTypeNormal, "Created", "Created HTTPRoute %q", "name-external-0-redirect"),
+		},
+	}}
+
+	table.Test(t, makeFactoryWithConfig(false, redirectConfig))
+}
+
+func TestReconcileHostRewrite(t *testing.T) {
+	rewriteConfig := defaultConfig.DeepCopy()
+	rewriteConfig.Gateway.HostRewrites = map[string]gatewayv1alpha1.LocalObjectReference{
+		"istio": {
+			Group: "example.com",
+			Kind:  "HostRewrite",
+			Name:  "auto",
+		},
+	}
+
+	table := TableTest{{
+		Name: "host rewritten by the filter of the GatewayClass",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass, withRewriteHost("foo.com")),
+		),
+		WantCreates: []runtime.Object{
+			routeWithConfig(t, rewriteConfig, ing(withBasicSpec, withGatewayAPIClass, withRewriteHost("foo.com")), resources.MakeHTTPRoute),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withRewriteHost("foo.com"), withHTTPRouteNotReady),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeNormal, "Created", "Created HTTPRoute %q", "name-external-0"),
+		},
+	}}
+
+	table.Test(t, makeFactoryWithConfig(false, rewriteConfig))
+}
+
+func TestReconcileTLSSecrets(t *testing.T) {
+	withOrigin := withTLSFrom("knative-serving", "cert")
+	origin := tlsSecret("knative-serving", "cert")
+	copyOf := func(i *v1alpha1.Ingress, origin *corev1.Secret) *corev1.Secret {
+		return resources.MakeSecret(i, &i.Spec.TLS[0], origin)
+	}
+	renewed := tlsSecret("knative-serving", "cert")
+	renewed.Data[corev1.TLSCertKey] = []byte("renewed")
+	otherCopy := copyOf(ing(withBasicSpec, withGatewayAPIClass, withOrigin), origin)
+	otherCopy.OwnerReferences = []metav1.OwnerReference{
+		*kmeta.NewControllerRef(ing(withBasicSpec, withGatewayAPIClass, withName("other"))),
+	}
+
+	table := TableTest{{
+		Name: "TLS secret of another namespace is copied",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass, withOrigin),
+			origin,
+		),
+		WantCreates: []runtime.Object{
+			httpRoute(t, ing(withBasicSpec, withGatewayAPIClass, withOrigin)),
+			copyOf(ing(withBasicSpec, withGatewayAPIClass, withOrigin), origin),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withOrigin, withHTTPRouteNotReady),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeNormal, "Created", "Created Secret %q", "name-knative-serving-cert-a9e0b4c89cb5b917"),
+			Eventf(corev1.EventTypeNormal, "Created", "Created HTTPRoute %q", "name-external-0"),
+		},
+	}, {
+		Name: "copy follows the renewed TLS secret",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass, withOrigin),
+			renewed,
+			copyOf(ing(withBasicSpec, withGatewayAPIClass, withOrigin), origin),
+			httpRoute(t, ing(withBasicSpec, withGatewayAPIClass, withOrigin)),
+		),
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: copyOf(ing(withBasicSpec, withGatewayAPIClass, withOrigin), renewed),
+		}},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withOrigin, withHTTPRouteNotReady),
+		}},
+	}, {
+		Name:    "copy controlled by another Ingress",
+		Key:     "ns/name",
+		WantErr: true,
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass, withOrigin),
+			origin,
+			otherCopy,
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withOrigin, withGatewayInvalid("SecretNotOwned",
+				`There is an existing Secret "name-knative-serving-cert-a9e0b4c89cb5b917" controlled by Ingress "other".`)),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeWarning, "InternalError", `ingress "name" does not own Secret "name-knative-serving-cert-a9e0b4c89cb5b917": resource is not owned by the Ingress`),
+		},
+	}, {
+		Name: "stale copy is deleted",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+			copyOf(ing(withBasicSpec, withGatewayAPIClass, withOrigin), origin),
+			httpRoute(t, ing(withBasicSpec, withGatewayAPIClass)),
+		),
+		WantDeletes: []clientgotesting.DeleteActionImpl{{
+			ActionImpl: clientgotesting.ActionImpl{
+				Namespace: "ns",
+				Verb:      "delete",
+				Resource:  corev1.SchemeGroupVersion.WithResource("secrets"),
+			},
+			Name: "name-knative-serving-cert-a9e0b4c89cb5b917",
+		}},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withHTTPRouteNotReady),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeNormal, "Deleted", "Deleted Secret %q", "name-knative-serving-cert-a9e0b4c89cb5b917"),
+		},
+	}}
+
+	table.Test(t, makeFactory(false))
+}
+
+func withTLS(secretName string) IngressOption {
+	return func(i *v1alpha1.Ingress) {
+		i.Spec.TLS = append(i.Spec.TLS, v1alpha1.IngressTLS{
+			Hosts:           []string{"example.com"},
+			SecretName:      secretName,
+			SecretNamespace: i.Namespace,
+		})
+	}
+}
+
+// withTLSFrom adds a TLS entry of the secret in the given namespace.
+func withTLSFrom(namespace, secretName string) IngressOption {
+	return func(i *v1alpha1.Ingress) {
+		i.Spec.TLS = append(i.Spec.TLS, v1alpha1.IngressTLS{
+			Hosts:           []string{"example.com"},
+			SecretName:      secretName,
+			SecretNamespace: namespace,
+		})
+	}
+}
+
+func tlsSecret(namespace, name string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       []byte("cert"),
+			corev1.TLSPrivateKeyKey: []byte("key"),
+		},
+		Type: corev1.SecretTypeTLS,
+	}
+}
+
+func withListenerStatus(gw *gatewayv1alpha1.Gateway, host string, cond metav1.Condition) *gatewayv1alpha1.Gateway {
+	hostname := gatewayv1alpha1.Hostname(host)
+	gw.Status.Listeners = append(gw.Status.Listeners, gatewayv1alpha1.ListenerStatus{
+		Port:       443,
+		Protocol:   gatewayv1alpha1.HTTPSProtocolType,
+		Hostname:   &hostname,
+		Conditions: []metav1.Condition{cond},
+	})
+	return gw
+}
+
+func TestReconcileGatewayAnnotation(t *testing.T) {
+	allowedConfig := defaultConfig.DeepCopy()
+	allowedConfig.Gateway.Gateways[v1alpha1.IngressVisibilityExternalIP].AllowedGateways = []config.AllowedGateway{{
+		Gateway: "partner/partner-gateway",
+		Service: "partner/partner-ingressgateway",
+	}}
+	ctx := (&testConfigStore{config: allowedConfig}).ToContext(context.Background())
+	partnerRoute := func(i *v1alpha1.Ingress) *gatewayv1alpha1.HTTPRoute {
+		if _, err := ingress.InsertProbe(i); err != nil {
+			t.Fatal("InsertProbe() =", err)
+		}
+		route, err := resources.MakeHTTPRoute(ctx, i, 0)
+		if err != nil {
+			t.Fatal("MakeHTTPRoute() =", err)
+		}
+		return route
+	}
+	partnerGateway := gateway("partner-gateway", func(gw *gatewayv1alpha1.Gateway) {
+		gw.Namespace = "partner"
+	})
+
+	table := TableTest{{
+		Name: "HTTPRoute is attached to the allowed Gateway",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass, withGatewayAnnotation("partner/partner-gateway")),
+			partnerGateway,
+		),
+		WantCreates: []runtime.Object{
+			partnerRoute(ing(withBasicSpec, withGatewayAPIClass, withGatewayAnnotation("partner/partner-gateway"))),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withGatewayAnnotation("partner/partner-gateway"),
+				withHTTPRouteNotReady),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeNormal, "Created", "Created HTTPRoute %q", "name-external-0"),
+		},
+	}, {
+		Name: "allowed Gateway does not exist",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass, withGatewayAnnotation("partner/partner-gateway")),
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withGatewayAnnotation("partner/partner-gateway"),
+				withGatewayInvalid("GatewayNotFound", `Gateway "partner/partner-gateway" does not exist.`)),
+		}},
+	}, {
+		Name: "Gateway not allowed",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass, withGatewayAnnotation("other/other-gateway")),
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withGatewayAnnotation("other/other-gateway"),
+				withGatewayInvalid("GatewayNotAllowed", `Gateway "other/other-gateway" of annotation `+
+					`"gateway-api.networking.knative.dev/gateway" is not allowed by config-gateway.`)),
+		}},
+	}}
+
+	table.Test(t, makeFactoryWithConfig(false, allowedConfig))
+}
+
+func TestReconcileGatewaySelectors(t *testing.T) {
+	selectorConfig := defaultConfig.DeepCopy()
+	selectorConfig.Gateway.Gateways[v1alpha1.IngressVisibilityExternalIP].Selectors = []config.GatewaySelector{{
+		NamespaceSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"region": "eu"},
+		},
+		Gateway: "istio-system/eu-gateway",
+		Service: "istio-system/eu-ingressgateway",
+	}}
+	euLabels := map[string]string{"region": "eu"}
+	euRoute := func(i *v1alpha1.Ingress) *gatewayv1alpha1.HTTPRoute {
+		if _, err := ingress.InsertProbe(i); err != nil {
+			t.Fatal("InsertProbe() =", err)
+		}
+		ctx := (&testConfigStore{config: selectorConfig}).ToContext(context.Background())
+		route, err := resources.MakeHTTPRoute(config.WithNamespaceLabels(ctx, euLabels), i, 0)
+		if err != nil {
+			t.Fatal("MakeHTTPRoute() =", err)
+		}
+		return route
+	}
+
+	table := TableTest{{
+		Name: "HTTPRoute is attached to the Gateway selecting the namespace",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+			gateway("eu-gateway"),
+			&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "ns",
+					Labels: euLabels,
+				},
+			},
+		),
+		WantCreates: []runtime.Object{
+			euRoute(ing(withBasicSpec, withGatewayAPIClass)),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withHTTPRouteNotReady),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeNormal, "Created", "Created HTTPRoute %q", "name-external-0"),
+		},
+	}, {
+		Name: "HTTPRoute is attached to the default Gateway without matching selector",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+			gateway("eu-gateway"),
+			&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "ns",
+					Labels: map[string]string{"region": "us"},
+				},
+			},
+		),
+		WantCreates: []runtime.Object{
+			httpRoute(t, ing(withBasicSpec, withGatewayAPIClass)),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withHTTPRouteNotReady),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeNormal, "Created", "Created HTTPRoute %q", "name-external-0"),
+		},
+	}, {
+		Name: "selected Gateway does not exist",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+			&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "ns",
+					Labels: euLabels,
+				},
+			},
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass,
+				withGatewayInvalid("GatewayNotFound", `Gateway "istio-system/eu-gateway" does not exist.`)),
+		}},
+	}}
+
+	table.Test(t, makeFactoryWithConfig(false, selectorConfig))
+}
+
+func TestReconcileAdditionalGateways(t *testing.T) {
+	vpnConfig := defaultConfig.DeepCopy()
+	vpnConfig.Gateway.Gateways[v1alpha1.IngressVisibilityExternalIP].AdditionalGateways = []config.AdditionalGateway{{
+		Gateway: "istio-system/vpn-gateway",
+		Service: "istio-system/vpn-ingressgateway",
+	}}
+	allConfig := vpnConfig.DeepCopy()
+	vpnConfig.Gateway.Gateways[v1alpha1.IngressVisibilityClusterLocal].AdditionalGateways = []config.AdditionalGateway{{
+		Gateway: "istio-system/vpn-local-gateway",
+		Service: "istio-system/vpn-local-gateway",
+	}}
+	// The quorum is only verified by the conditions, see config-gateway.
+	for _, visibility := range visibilities {
+		vpnConfig.Gateway.Gateways[visibility].Readiness = config.ReadinessConditions
+		vpnConfig.Gateway.Gateways[visibility].Quorum = 1
+	}
+	vpnRouteAt := func(i *v1alpha1.Ingress, index int) *gatewayv1alpha1.HTTPRoute {
+		if _, err := ingress.InsertProbe(i); err != nil {
+			t.Fatal("InsertProbe() =", err)
+		}
+		ctx := (&testConfigStore{config: vpnConfig}).ToContext(context.Background())
+		route, err := resources.MakeHTTPRoute(ctx, i, index)
+		if err != nil {
+			t.Fatal("MakeHTTPRoute() =", err)
+		}
+		return route
+	}
+	vpnRoute := func(i *v1alpha1.Ingress) *gatewayv1alpha1.HTTPRoute {
+		return vpnRouteAt(i, 0)
+	}
+
+	table := TableTest{{
+		Name: "load balancers of all Gateways once admitted by the quorum",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+			withAdmitted(vpnRoute(ing(withBasicSpec, withGatewayAPIClass))),
+			gateway("knative-gateway", withGatewayAddress("1.2.3.4")),
+			gateway("vpn-gateway", withGatewayAddress("10.0.0.1"), withGatewayReady(metav1.ConditionTrue)),
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withLoadBalancers(
+				[]v1alpha1.LoadBalancerIngressStatus{
+					{DomainInternal: "istio-ingressgateway.istio-system.svc.cluster.local"},
+					{IP: "1.2.3.4"},
+					{DomainInternal: "vpn-ingressgateway.istio-system.svc.cluster.local"},
+					{IP: "10.0.0.1"},
+				},
+				[]v1alpha1.LoadBalancerIngressStatus{
+					{DomainInternal: "knative-local-gateway.istio-system.svc.cluster.local"},
+				},
+			)),
+		}},
+	}, {
+		Name: "additional Gateway does not exist within the quorum",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+			withAdmitted(vpnRoute(ing(withBasicSpec, withGatewayAPIClass))),
+			gateway("knative-gateway", withGatewayAddress("1.2.3.4")),
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withLoadBalancers(
+				[]v1alpha1.LoadBalancerIngressStatus{
+					{DomainInternal: "istio-ingressgateway.istio-system.svc.cluster.local"},
+					{IP: "1.2.3.4"},
+				},
+				[]v1alpha1.LoadBalancerIngressStatus{
+					{DomainInternal: "knative-local-gateway.istio-system.svc.cluster.local"},
+				},
+			)),
+		}},
+	}, {
+		Name: "additional Gateway is not Ready within the quorum",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+			withAdmitted(vpnRoute(ing(withBasicSpec, withGatewayAPIClass))),
+			gateway("knative-gateway", withGatewayAddress("1.2.3.4")),
+			gateway("vpn-gateway", withGatewayAddress("10.0.0.1"), withGatewayReady(metav1.ConditionFalse)),
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withLoadBalancers(
+				[]v1alpha1.LoadBalancerIngressStatus{
+					{DomainInternal: "istio-ingressgateway.istio-system.svc.cluster.local"},
+					{IP: "1.2.3.4"},
+				},
+				[]v1alpha1.LoadBalancerIngressStatus{
+					{DomainInternal: "knative-local-gateway.istio-system.svc.cluster.local"},
+				},
+			)),
+		}},
+	}, {
+		Name: "additional cluster-local Gateway is not advertised",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass, withLocalRule),
+			withAdmitted(vpnRoute(ing(withBasicSpec, withGatewayAPIClass, withLocalRule))),
+			withAdmitted(vpnRouteAt(ing(withBasicSpec, withGatewayAPIClass, withLocalRule), 1)),
+			gateway("knative-gateway", withGatewayAddress("1.2.3.4")),
+			gateway("vpn-local-gateway", withGatewayReady(metav1.ConditionTrue)),
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass, withLocalRule, withLoadBalancers(
+				[]v1alpha1.LoadBalancerIngressStatus{
+					{DomainInternal: "istio-ingressgateway.istio-system.svc.cluster.local"},
+					{IP: "1.2.3.4"},
+				},
+				[]v1alpha1.LoadBalancerIngressStatus{
+					{DomainInternal: "knative-local-gateway.istio-system.svc.cluster.local"},
+				},
+			)),
+		}},
+	}, {
+		Name: "Gateway of the Ingress does not exist",
+		Key:  "ns/name",
+		Objects: []runtime.Object{
+			ing(withBasicSpec, withGatewayAPIClass),
+			gateway("knative-local-gateway"),
+			gateway("vpn-gateway"),
+			gatewayClass("istio", withGatewayClassAdmitted(metav1.ConditionTrue)),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass,
+				withGatewayInvalid("GatewayNotFound", `Gateway "istio-system/knative-gateway" does not exist.`)),
+		}},
+	}}
+
+	table.Test(t, makeFactoryWithConfig(true, vpnConfig))
+
+	table = TableTest{{
+		Name: "additional Gateway does not exist",
+		Key:  "ns/name",
+		Objects: withGateways(
+			ing(withBasicSpec, withGatewayAPIClass),
+		),
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: ing(withBasicSpec, withGatewayAPIClass,
+				withGatewayInvalid("GatewayNotFound", `Gateway "istio-system/vpn-gateway" does not exist.`)),
+		}},
+	}}
+
+	table.Test(t, makeFactoryWithConfig(true, allConfig))
+}
+
+func withGatewayAnnotation(key string) IngressOption {
+	return withAnnotation(map[string]string{config.GatewayAnnotationKey: key})
+}
+
+func withMirrorAnnotation(value string) IngressOption {
+	return withAnnotation(map[string]string{resources.MirrorAnnotationKey: value})
+}
+
+// updateGateways accepts the updates of Gateways, which the object tracker of
+// the fake client cannot find as it guesses their resource to be "gatewaies".
+func updateGateways(action clientgotesting.Action) (bool, runtime.Object, error) {
+	if !action.Matches("update", "gateways") {
+		return false, nil, nil
+	}
+	return true, action.(clientgotesting.UpdateAction).GetObject(), nil
+}
+
+// makeFactory returns the factory of the reconciler whose probes report the
+// given readiness.
+func makeFactory(ready bool) Factory {
+	return makeFactoryWithConfig(ready, defaultConfig)
+}
+
+// makeFactoryWithConfig is makeFactory reconciling with the given config.
+func makeFactoryWithConfig(ready bool, cfg *config.Config) Factory {
+	return MakeFactory(func(ctx context.Context, listers *Listers, cmw configmap.Watcher) controller.Reconciler {
 		r := &Reconciler{
+			kubeclient:  fakekubeclient.Get(ctx),
 			gwapiclient: fakegwapiclientset.Get(ctx),
 			// Listers index properties about resources
-			httprouteLister: listers.GetHTTPRouteLister(),
+			ingressLister:           listers.GetIngressLister(),
+			httprouteLister:         listers.GetHTTPRouteLister(),
+			gatewayLister:           listers.GetGatewayLister(),
+			gatewayClassLister:      listers.GetGatewayClassLister(),
+			namespaceLister:         listers.GetNamespaceLister(),
+			secretLister:            listers.GetSecretLister(),
+			certificateSecretLister: listers.GetSecretLister(),
+			serviceLister:           listers.GetServiceLister(),
+			tracker:                 &NullTracker{},
 			statusManager: &fakeStatusManager{
 				FakeIsReady: func(context.Context, *v1alpha1.Ingress) (bool, error) {
-					return false, theError
+					return ready, nil
 				},
 			},
 		}
@@ -64,11 +1129,76 @@ func TestReconcile(t *testing.T) {
 			listers.GetIngressLister(), controller.GetEventRecorder(ctx), r, GatewayAPIIngressClassName,
 			controller.Options{
 				ConfigStore: &testConfigStore{
-					config: defaultConfig,
+					config: cfg,
 				}})
 
 		return ingr
-	}))
+	})
+}
+
+// routeWithConfig returns the HTTPRoute generated by fn for the first rule of
+// the Ingress with the given config.
+func routeWithConfig(t *testing.T, cfg *config.Config, i *v1alpha1.Ingress,
+	fn func(context.Context, *v1alpha1.Ingress, int) (*gatewayv1alpha1.HTTPRoute, error)) *gatewayv1alpha1.HTTPRoute {
+	t.Helper()
+	ctx := (&testConfigStore{config: cfg}).ToContext(context.Background())
+	if _, err := ingress.InsertProbe(i); err != nil {
+		t.Fatal("InsertProbe() =", err)
+	}
+	route, err := fn(ctx, i, 0)
+	if err != nil {
+		t.Fatal("Failed to make HTTPRoute:", err)
+	}
+	return route
+}
+
+// httpRoute returns the HTTPRoute generated for the first rule of the Ingress.
+func httpRoute(t *testing.T, i *v1alpha1.Ingress) *gatewayv1alpha1.HTTPRoute {
+	t.Helper()
+	return httpRouteAt(t, i, 0)
+}
+
+// httpRouteAt returns the HTTPRoute generated for the rule at the index.
+func httpRouteAt(t *testing.T, i *v1alpha1.Ingress, index int) *gatewayv1alpha1.HTTPRoute {
+	t.Helper()
+	ctx := (&testConfigStore{config: defaultConfig}).ToContext(context.Background())
+	if _, err := ingress.InsertProbe(i); err != nil {
+		t.Fatal("InsertProbe() =", err)
+	}
+	route, err := resources.MakeHTTPRoute(ctx, i, index)
+	if err != nil {
+		t.Fatal("MakeHTTPRoute() =", err)
+	}
+	return route
+}
+
+func httpRouteOwnedBy(name string, i *v1alpha1.Ingress) *gatewayv1alpha1.HTTPRoute {
+	return &gatewayv1alpha1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       i.Namespace,
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(i)},
+		},
+	}
+}
+
+func withName(name string) IngressOption {
+	return func(i *v1alpha1.Ingress) {
+		i.Name = name
+		i.UID = types.UID(name)
+	}
+}
+
+func withHTTPRouteNotReady(i *v1alpha1.Ingress) {
+	withHTTPRoutesNotReady(`Waiting for HTTPRoute "name-external-0" to be admitted by its Gateways.`)(i)
+}
+
+func withHTTPRoutesNotReady(msg string) IngressOption {
+	return func(i *v1alpha1.Ingress) {
+		i.Status.InitializeConditions()
+		i.Status.MarkIngressNotReady("HTTPRouteNotReady", msg)
+		i.Status.MarkLoadBalancerNotReady()
+	}
 }
 
 type fakeStatusManager struct {
@@ -92,10 +1222,376 @@ var (
 		Network: &network.Config{},
 		Gateway: &config.Gateway{
 			Gateways: map[v1alpha1.IngressVisibility]*config.GatewayConfig{
-				v1alpha1.IngressVisibilityExternalIP: {},
+				v1alpha1.IngressVisibilityExternalIP: {
+					GatewayClass: "istio",
+					Gateway:      "istio-system/knative-gateway",
+					Service:      "istio-system/istio-ingressgateway",
+				},
 				v1alpha1.IngressVisibilityClusterLocal: {
-					Service: "istio-system/knative-local-gateway",
+					GatewayClass: "istio",
+					Gateway:      "istio-system/knative-local-gateway",
+					Service:      "istio-system/knative-local-gateway",
 				}},
 		},
 	}
 )
+
+func withGatewayInvalid(reason, message string) IngressOption {
+	return func(i *v1alpha1.Ingress) {
+		i.Status.InitializeConditions()
+		i.GetConditionSet().Manage(i.GetStatus()).MarkFalse(v1alpha1.IngressConditionNetworkConfigured,
+			reason, message)
+	}
+}
+
+func withHTTPRouteNotOwned(route, owner string) IngressOption {
+	return func(i *v1alpha1.Ingress) {
+		i.Status.InitializeConditions()
+		i.GetConditionSet().Manage(i.GetStatus()).MarkFalse(v1alpha1.IngressConditionNetworkConfigured,
+			"HTTPRouteNotOwned", "There is an existing HTTPRoute %q controlled by Ingress %q.", route, owner)
+	}
+}
+
+// withACMEChallenge adds an ACME HTTP-01 challenge path to the first rule.
+func withACMEChallenge(i *v1alpha1.Ingress) {
+	i.Spec.Rules[0].HTTP.Paths = append(i.Spec.Rules[0].HTTP.Paths, v1alpha1.HTTPIngressPath{
+		Path: resources.ACMEChallengePathPrefix + "token",
+		Splits: []v1alpha1.IngressBackendSplit{{
+			IngressBackend: v1alpha1.IngressBackend{
+				ServiceName:      "solver",
+				ServiceNamespace: i.Namespace,
+				ServicePort:      intstr.FromInt(8089),
+			},
+			Percent: 100,
+		}},
+	})
+}
+
+// withRewriteHost rewrites the host of the first path of the first rule.
+func withRewriteHost(host string) IngressOption {
+	return func(i *v1alpha1.Ingress) {
+		i.Spec.Rules[0].HTTP.Paths[0].RewriteHost = host
+	}
+}
+
+func withHTTPRedirectNotConfigured(i *v1alpha1.Ingress) {
+	i.GetConditionSet().Manage(i.GetStatus()).MarkFalse(ConditionHTTPRedirectConfigured,
+		"HTTPRedirectNotConfigured", "No httpRedirect is configured in config-gateway, "+
+			"plain HTTP requests are served instead of redirected to HTTPS.")
+}
+
+func withNetworkConfigured(i *v1alpha1.Ingress) {
+	i.Status.InitializeConditions()
+	i.Status.MarkNetworkConfigured()
+	i.Status.MarkLoadBalancerNotReady()
+}
+
+func withAdmitted(r *gatewayv1alpha1.HTTPRoute) *gatewayv1alpha1.HTTPRoute {
+	ref := r.Spec.Gateways.GatewayRefs[0]
+	r.Status.Gateways = []gatewayv1alpha1.RouteGatewayStatus{{
+		GatewayRef: gatewayv1alpha1.RouteStatusGatewayReference{
+			Namespace: ref.Namespace,
+			Name:      ref.Name,
+		},
+		Conditions: []metav1.Condition{{
+			Type:   string(gatewayv1alpha1.ConditionRouteAdmitted),
+			Status: metav1.ConditionTrue,
+		}},
+	}}
+	return r
+}
+
+func withLoadBalancers(public, private []v1alpha1.LoadBalancerIngressStatus) IngressOption {
+	return func(i *v1alpha1.Ingress) {
+		i.Status.InitializeConditions()
+		i.Status.MarkNetworkConfigured()
+		i.Status.MarkLoadBalancerReady(public, private)
+	}
+}
+
+// withGateways adds the Gateways and the GatewayClass of defaultConfig to the
+// objects, unless the objects have them already.
+func withGateways(objs ...runtime.Object) []runtime.Object {
+	has := func(kind, name string) bool {
+		for _, obj := range objs {
+			if o, ok := obj.(metav1.Object); ok && o.GetName() == name &&
+				reflect.TypeOf(obj).Elem().Name() == kind {
+				return true
+			}
+		}
+		return false
+	}
+	for _, name := range []string{"knative-gateway", "knative-local-gateway"} {
+		if !has("Gateway", name) {
+			objs = append(objs, gateway(name))
+		}
+	}
+	if !has("GatewayClass", "istio") {
+		objs = append(objs, gatewayClass("istio", withGatewayClassAdmitted(metav1.ConditionTrue)))
+	}
+	return objs
+}
+
+// gateway returns the Gateway of the class "istio" with the listener which
+// accepts any HTTPRoute.
+func gateway(name string, opts ...func(*gatewayv1alpha1.Gateway)) *gatewayv1alpha1.Gateway {
+	all := gatewayv1alpha1.RouteSelectAll
+	gw := &gatewayv1alpha1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "istio-system",
+		},
+		Spec: gatewayv1alpha1.GatewaySpec{
+			GatewayClassName: "istio",
+			Listeners: []gatewayv1alpha1.Listener{{
+				Protocol: gatewayv1alpha1.HTTPProtocolType,
+				Port:     80,
+				Routes: gatewayv1alpha1.RouteBindingSelector{
+					Kind:       "HTTPRoute",
+					Namespaces: &gatewayv1alpha1.RouteNamespaces{From: &all},
+				},
+			}},
+		},
+	}
+	for _, opt := range opts {
+		opt(gw)
+	}
+	return gw
+}
+
+func gatewayClass(name string, opts ...func(*gatewayv1alpha1.GatewayClass)) *gatewayv1alpha1.GatewayClass {
+	gwc := &gatewayv1alpha1.GatewayClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+	}
+	for _, opt := range opts {
+		opt(gwc)
+	}
+	return gwc
+}
+
+func withGatewayClassAdmitted(s metav1.ConditionStatus) func(*gatewayv1alpha1.GatewayClass) {
+	return func(gwc *gatewayv1alpha1.GatewayClass) {
+		gwc.Status.Conditions = append(gwc.Status.Conditions, metav1.Condition{
+			Type:    string(gatewayv1alpha1.GatewayClassConditionStatusAdmitted),
+			Status:  s,
+			Reason:  "Test",
+			Message: "test",
+		})
+	}
+}
+
+func withGatewayAddress(ip string) func(*gatewayv1alpha1.Gateway) {
+	return func(gw *gatewayv1alpha1.Gateway) {
+		gw.Status.Addresses = append(gw.Status.Addresses, gatewayv1alpha1.GatewayAddress{Value: ip})
+	}
+}
+
+func service(name string, opts ...func(*corev1.Service)) *corev1.Service {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "istio-system",
+		},
+	}
+	for _, opt := range opts {
+		opt(svc)
+	}
+	return svc
+}
+
+func withServiceNamespace(ns string) func(*corev1.Service) {
+	return func(svc *corev1.Service) {
+		svc.Namespace = ns
+	}
+}
+
+func withLoadBalancerHostname(hostname string) func(*corev1.Service) {
+	return func(svc *corev1.Service) {
+		svc.Status.LoadBalancer.Ingress = append(svc.Status.LoadBalancer.Ingress,
+			corev1.LoadBalancerIngress{Hostname: hostname})
+	}
+}
+
+func withLocalRule(i *v1alpha1.Ingress) {
+	i.Spec.Rules = append(i.Spec.Rules, v1alpha1.IngressRule{
+		Hosts:      []string{"name.ns.svc.cluster.local"},
+		Visibility: v1alpha1.IngressVisibilityClusterLocal,
+		HTTP:       i.Spec.Rules[0].HTTP.DeepCopy(),
+	})
+}
+
+func TestIsHTTPRouteReady(t *testing.T) {
+	route := func(gateways ...gatewayv1alpha1.RouteGatewayStatus) *gatewayv1alpha1.HTTPRoute {
+		return &gatewayv1alpha1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "route"},
+			Spec: gatewayv1alpha1.HTTPRouteSpec{
+				Gateways: &gatewayv1alpha1.RouteGateways{
+					GatewayRefs: []gatewayv1alpha1.GatewayReference{{
+						Namespace: "istio-system",
+						Name:      "knative-gateway",
+					}},
+				},
+			},
+			Status: gatewayv1alpha1.HTTPRouteStatus{
+				RouteStatus: gatewayv1alpha1.RouteStatus{Gateways: gateways},
+			},
+		}
+	}
+	gatewayStatus := func(name string, conds ...metav1.Condition) gatewayv1alpha1.RouteGatewayStatus {
+		return gatewayv1alpha1.RouteGatewayStatus{
+			GatewayRef: gatewayv1alpha1.RouteStatusGatewayReference{
+				Namespace: "istio-system",
+				Name:      name,
+			},
+			Conditions: conds,
+		}
+	}
+	// vpnRoute is attached to the VPN gateway besides the knative gateway.
+	vpnRoute := func(gateways ...gatewayv1alpha1.RouteGatewayStatus) *gatewayv1alpha1.HTTPRoute {
+		r := route(gateways...)
+		r.Spec.Gateways.GatewayRefs = append(r.Spec.Gateways.GatewayRefs, gatewayv1alpha1.GatewayReference{
+			Namespace: "istio-system",
+			Name:      "vpn-gateway",
+		})
+		return r
+	}
+	admitted := metav1.Condition{
+		Type:   string(gatewayv1alpha1.ConditionRouteAdmitted),
+		Status: metav1.ConditionTrue,
+	}
+
+	for _, tc := range []struct {
+		name      string
+		route     *gatewayv1alpha1.HTTPRoute
+		quorum    int
+		wantReady bool
+		wantMsg   string
+	}{{
+		name:    "no status",
+		route:   route(),
+		wantMsg: `Waiting for HTTPRoute "route" to be admitted by its Gateways.`,
+	}, {
+		name:    "status of another gateway",
+		route:   route(gatewayStatus("other")),
+		wantMsg: `Waiting for Gateway "istio-system/knative-gateway" to admit HTTPRoute "route".`,
+	}, {
+		name:    "no admitted condition",
+		route:   route(gatewayStatus("knative-gateway")),
+		wantMsg: `Waiting for Gateway "istio-system/knative-gateway" to admit HTTPRoute "route".`,
+	}, {
+		name: "not admitted",
+		route: route(gatewayStatus("knative-gateway", metav1.Condition{
+			Type:    string(gatewayv1alpha1.ConditionRouteAdmitted),
+			Status:  metav1.ConditionFalse,
+			Reason:  "InvalidRoute",
+			Message: "bad route",
+		})),
+		wantMsg: `HTTPRoute "route" is not admitted by Gateway "istio-system/knative-gateway": InvalidRoute: bad route`,
+	}, {
+		name: "admitted",
+		route: route(gatewayStatus("knative-gateway", metav1.Condition{
+			Type:   string(gatewayv1alpha1.ConditionRouteAdmitted),
+			Status: metav1.ConditionTrue,
+		})),
+		wantReady: true,
+	}, {
+		name:    "admitted by one of all gateways",
+		route:   vpnRoute(gatewayStatus("knative-gateway", admitted), gatewayStatus("vpn-gateway")),
+		wantMsg: `Waiting for Gateway "istio-system/vpn-gateway" to admit HTTPRoute "route".`,
+	}, {
+		name:      "admitted by all gateways",
+		route:     vpnRoute(gatewayStatus("knative-gateway", admitted), gatewayStatus("vpn-gateway", admitted)),
+		wantReady: true,
+	}, {
+		name:      "admitted by the quorum",
+		route:     vpnRoute(gatewayStatus("vpn-gateway", admitted)),
+		quorum:    1,
+		wantReady: true,
+	}, {
+		name: "not admitted by the quorum",
+		route: vpnRoute(gatewayStatus("knative-gateway", metav1.Condition{
+			Type:    string(gatewayv1alpha1.ConditionRouteAdmitted),
+			Status:  metav1.ConditionFalse,
+			Reason:  "InvalidRoute",
+			Message: "bad route",
+		}), gatewayStatus("vpn-gateway")),
+		quorum:  1,
+		wantMsg: `HTTPRoute "route" is not admitted by Gateway "istio-system/knative-gateway": InvalidRoute: bad route`,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			ready, msg := IsHTTPRouteReady(tc.route, tc.quorum)
+			if ready != tc.wantReady || msg != tc.wantMsg {
+				t.Errorf("IsHTTPRouteReady() = (%v, %q), want (%v, %q)", ready, msg, tc.wantReady, tc.wantMsg)
+			}
+		})
+	}
+}
+
+func TestTrackGateways(t *testing.T) {
+	tr := &recordingTracker{}
+	r := &Reconciler{tracker: tr}
+
+	ctx := (&testConfigStore{config: defaultConfig}).ToContext(context.Background())
+
+	if err := r.trackGateways(ctx, ing(withBasicSpec)); err != nil {
+		t.Fatal("trackGateways() =", err)
+	}
+
+	want := []tracker.Reference{{
+		APIVersion: "networking.x-k8s.io/v1alpha1",
+		Kind:       "Gateway",
+		Namespace:  "istio-system",
+		Name:       "knative-gateway",
+	}, {
+		APIVersion: "networking.x-k8s.io/v1alpha1",
+		Kind:       "GatewayClass",
+		Name:       "istio",
+	}, {
+		APIVersion: "networking.x-k8s.io/v1alpha1",
+		Kind:       "Gateway",
+		Namespace:  "istio-system",
+		Name:       "knative-local-gateway",
+	}, {
+		APIVersion: "networking.x-k8s.io/v1alpha1",
+		Kind:       "GatewayClass",
+		Name:       "istio",
+	}}
+	if !cmp.Equal(want, tr.refs) {
+		t.Error("Tracked references (-want, +got) =", cmp.Diff(want, tr.refs))
+	}
+}
+
+func TestTrackMirrorService(t *testing.T) {
+	tr := &recordingTracker{}
+	listers := NewListers(nil)
+	r := &Reconciler{tracker: tr, serviceLister: listers.GetServiceLister()}
+
+	// The missing Service is tracked to route the Ingress once it appears.
+	valid, err := r.isMirrorValid(ing(withBasicSpec, withMirrorAnnotation("shadow:80")))
+	if err != nil || valid {
+		t.Fatalf("isMirrorValid() = (%v, %v), want (false, nil)", valid, err)
+	}
+
+	want := []tracker.Reference{{
+		APIVersion: "v1",
+		Kind:       "Service",
+		Namespace:  "ns",
+		Name:       "shadow",
+	}}
+	if !cmp.Equal(want, tr.refs) {
+		t.Error("Tracked references (-want, +got) =", cmp.Diff(want, tr.refs))
+	}
+}
+
+// recordingTracker records the tracked references.
+type recordingTracker struct {
+	NullTracker
+	refs []tracker.Reference
+}
+
+func (t *recordingTracker) TrackReference(ref tracker.Reference, obj interface{}) error {
+	t.refs = append(t.refs, ref)
+	return nil
+}
@@ -20,17 +20,27 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"strconv"
 
 	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/sets"
 	corev1listers "k8s.io/client-go/listers/core/v1"
+	discoveryv1listers "k8s.io/client-go/listers/discovery/v1"
 	"k8s.io/client-go/tools/cache"
 	"knative.dev/networking/pkg/apis/networking/v1alpha1"
 	"knative.dev/networking/pkg/status"
+	gatewayv1alpha1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
 
+	gwlisters "github.com/nak3/net-gateway-api/pkg/client/gatewayapi/listers/apis/v1alpha1"
 	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/config"
 )
 
+// The ports of the Istio gateway pods to probe, unless configured or derived.
 const (
 	// HTTPPortExternal is the port for external availability.
 	HTTPPortExternal = "8080"
@@ -40,72 +50,186 @@ const (
 	HTTPSPortExternal = "8443"
 )
 
-func NewProbeTargetLister(logger *zap.SugaredLogger, endpointsLister corev1listers.EndpointsLister) status.ProbeTargetLister {
-	return &gatewayPodTargetLister{
-		logger:          logger,
-		endpointsLister: endpointsLister,
+// NewProbeTargetLister returns the ProbeTargetLister which lists the probe
+// targets of each rule by the readiness strategy configured for its visibility.
+func NewProbeTargetLister(logger *zap.SugaredLogger, endpointSliceLister discoveryv1listers.EndpointSliceLister,
+	gatewayLister gwlisters.GatewayLister, serviceLister corev1listers.ServiceLister) status.ProbeTargetLister {
+	return &readinessTargetLister{
+		listers: map[config.ReadinessStrategy]status.ProbeTargetLister{
+			config.ReadinessPodProbe: &gatewayPodTargetLister{
+				logger:              logger,
+				endpointSliceLister: endpointSliceLister,
+				gatewayLister:       gatewayLister,
+				serviceLister:       serviceLister,
+			},
+			config.ReadinessGatewayProbe: &gatewayAddressTargetLister{
+				gatewayLister: gatewayLister,
+				serviceLister: serviceLister,
+			},
+		},
 	}
 }
 
 type gatewayPodTargetLister struct {
-	logger          *zap.SugaredLogger
-	endpointsLister corev1listers.EndpointsLister
+	logger              *zap.SugaredLogger
+	endpointSliceLister discoveryv1listers.EndpointSliceLister
+	gatewayLister       gwlisters.GatewayLister
+	serviceLister       corev1listers.ServiceLister
 }
 
 func (l *gatewayPodTargetLister) ListProbeTargets(ctx context.Context, ing *v1alpha1.Ingress) ([]status.ProbeTarget, error) {
 	gatewayConfig := config.FromContext(ctx).Gateway
-	ns, name, _ := cache.SplitMetaNamespaceKey(gatewayConfig.LookupService(v1alpha1.IngressVisibilityClusterLocal))
+	namespaceLabels := config.NamespaceLabelsFromContext(ctx)
 
-	eps, err := l.endpointsLister.Endpoints(ns).Get(name)
+	targets := make([]status.ProbeTarget, 0, len(ing.Spec.Rules))
+	for _, rule := range ing.Spec.Rules {
+		scheme := gatewayConfig.LookupProbeScheme(ing, rule.Visibility)
+
+		// Each rule is probed through the pods of every gateway for its visibility.
+		services := gatewayConfig.LookupServicesFor(ing, namespaceLabels, rule.Visibility)
+		for i, gwKey := range gatewayConfig.LookupGatewaysFor(ing, namespaceLabels, rule.Visibility) {
+			slices, ips, err := l.getGatewayPods(services[i])
+			if err != nil {
+				return nil, err
+			}
+			port, err := l.probePort(gatewayConfig, rule.Visibility, gwKey, services[i], scheme, slices)
+			if err != nil {
+				return nil, err
+			}
+
+			targets = append(targets, status.ProbeTarget{
+				PodIPs:  ips,
+				PodPort: port,
+				URLs:    domainsToURL(rule.Hosts, scheme),
+			})
+		}
+	}
+	return targets, nil
+}
+
+// getGatewayPods returns the EndpointSlices of the gateway service and the
+// addresses of its ready pods.
+func (l *gatewayPodTargetLister) getGatewayPods(key string) ([]*discoveryv1.EndpointSlice, sets.String, error) {
+	ns, name, _ := cache.SplitMetaNamespaceKey(key)
+	slices, err := l.endpointSliceLister.EndpointSlices(ns).List(labels.SelectorFromSet(labels.Set{
+		discoveryv1.LabelServiceName: name,
+	}))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get internal service: %w", err)
+		return nil, nil, fmt.Errorf("failed to list EndpointSlices of gateway service %q: %w", key, err)
+	}
+	if len(slices) == 0 {
+		return nil, nil, fmt.Errorf("no EndpointSlices found for gateway service %q", key)
 	}
 
-	var readyIPs []string
-	for _, sub := range eps.Subsets {
-		for _, address := range sub.Addresses {
-			readyIPs = append(readyIPs, address.IP)
+	ips := sets.NewString()
+	for _, slice := range slices {
+		ips = ips.Union(readyAddresses(slice))
+	}
+	if ips.Len() == 0 {
+		return nil, nil, fmt.Errorf("no gateway pods available for service %q", key)
+	}
+	return slices, ips, nil
+}
+
+// readyAddresses returns the addresses of the ready endpoints in the slice.
+// Both families of the dual-stack service are probed.
+func readyAddresses(slice *discoveryv1.EndpointSlice) sets.String {
+	ips := sets.NewString()
+	if slice.AddressType != discoveryv1.AddressTypeIPv4 && slice.AddressType != discoveryv1.AddressTypeIPv6 {
+		return ips
+	}
+	for _, ep := range slice.Endpoints {
+		if isEndpointReady(ep.Conditions) {
+			ips.Insert(ep.Addresses...)
 		}
 	}
-	if len(readyIPs) == 0 {
-		return nil, fmt.Errorf("no gateway pods available")
+	return ips
+}
+
+// isEndpointReady returns true if the endpoint is ready to serve the probes.
+// The terminating endpoints are excluded even when they are still serving, as
+// they would not serve the Ingress for long. Unknown conditions are ready.
+func isEndpointReady(c discoveryv1.EndpointConditions) bool {
+	if c.Terminating != nil && *c.Terminating {
+		return false
 	}
-	return l.getIngressUrls(ing, readyIPs)
+	if c.Serving != nil && !*c.Serving {
+		return false
+	}
+	return c.Ready == nil || *c.Ready
 }
 
-func (l *gatewayPodTargetLister) getIngressUrls(ing *v1alpha1.Ingress, gatewayIps []string) ([]status.ProbeTarget, error) {
-	ips := sets.NewString(gatewayIps...)
+// probePort returns the port of the pods of the gateway with the given key and
+// service to probe with the scheme. The configured port comes first, then the
+// targetPort of the service port which the Gateway listener of the scheme uses,
+// and the Istio ports at last.
+func (l *gatewayPodTargetLister) probePort(gatewayConfig *config.Gateway, visibility v1alpha1.IngressVisibility,
+	gwKey, key, scheme string, slices []*discoveryv1.EndpointSlice) (string, error) {
+	if port := gatewayConfig.LookupProbePort(visibility, scheme); port != 0 {
+		return strconv.Itoa(int(port)), nil
+	}
 
-	targets := make([]status.ProbeTarget, 0, len(ing.Spec.Rules))
-	for _, rule := range ing.Spec.Rules {
-		var target status.ProbeTarget
+	gw, err := getGateway(l.gatewayLister, gwKey)
+	if err != nil {
+		return "", err
+	}
+	if gw != nil {
+		ns, name, _ := cache.SplitMetaNamespaceKey(key)
+		svc, err := l.serviceLister.Services(ns).Get(name)
+		if err != nil && !apierrs.IsNotFound(err) {
+			return "", fmt.Errorf("failed to get gateway service %q: %w", key, err)
+		}
+		protocol := gatewayv1alpha1.HTTPProtocolType
+		if scheme == "https" {
+			protocol = gatewayv1alpha1.HTTPSProtocolType
+		}
+		if svc != nil {
+			if port := listenerTargetPort(gw, protocol, svc, slices); port != 0 {
+				return strconv.Itoa(int(port)), nil
+			}
+		}
+	}
 
-		domains := rule.Hosts
-		scheme := "http"
+	switch {
+	case scheme == "https":
+		return HTTPSPortExternal, nil
+	case visibility == v1alpha1.IngressVisibilityExternalIP:
+		return HTTPPortExternal, nil
+	default:
+		return HTTPPortInternal, nil
+	}
+}
 
-		if rule.Visibility == v1alpha1.IngressVisibilityExternalIP {
-			target = status.ProbeTarget{
-				PodIPs: ips,
+// listenerTargetPort returns the container port which the Gateway listener of
+// the protocol is served on, or zero if it cannot be resolved.
+func listenerTargetPort(gw *gatewayv1alpha1.Gateway, protocol gatewayv1alpha1.ProtocolType,
+	svc *corev1.Service, slices []*discoveryv1.EndpointSlice) int32 {
+	for _, listener := range gw.Spec.Listeners {
+		if listener.Protocol != protocol {
+			continue
+		}
+		for _, sp := range svc.Spec.Ports {
+			if sp.Port != int32(listener.Port) {
+				continue
 			}
-			if ing.Spec.HTTPOption == v1alpha1.HTTPOptionRedirected {
-				target.PodPort = HTTPSPortExternal
-				target.URLs = domainsToURL(domains, "https")
-			} else {
-				target.PodPort = HTTPPortExternal
-				target.URLs = domainsToURL(domains, scheme)
+			if sp.TargetPort.Type == intstr.Int {
+				if sp.TargetPort.IntVal == 0 {
+					// The targetPort defaults to the port.
+					return sp.Port
+				}
+				return sp.TargetPort.IntVal
 			}
-		} else {
-			target = status.ProbeTarget{
-				PodIPs:  ips,
-				PodPort: HTTPPortInternal,
-				URLs:    domainsToURL(domains, scheme),
+			// The named targetPort is resolved in the EndpointSlice port of the same name.
+			for _, slice := range slices {
+				for _, p := range slice.Ports {
+					if p.Name != nil && *p.Name == sp.Name && p.Port != nil {
+						return *p.Port
+					}
+				}
 			}
 		}
-
-		targets = append(targets, target)
-
 	}
-	return targets, nil
+	return 0
 }
 
 func domainsToURL(domains []string, scheme string) []*url.URL {
@@ -20,41 +20,48 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"strings"
 	"testing"
 
 	"knative.dev/networking/pkg/apis/networking"
 
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"knative.dev/networking/pkg/apis/networking/v1alpha1"
 	"knative.dev/networking/pkg/status"
+	gatewayv1alpha1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
 
 	"knative.dev/pkg/kmeta"
+	"knative.dev/pkg/ptr"
 
 	"github.com/google/go-cmp/cmp"
 
+	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/config"
 	. "github.com/nak3/net-gateway-api/pkg/reconciler/testing"
 )
 
 var (
 	privateNS   = "istio-system"
 	privateName = "knative-local-gateway"
+	publicName  = "istio-ingressgateway"
 )
 
 func TestListProbeTargets(t *testing.T) {
 	tests := []struct {
 		name    string
 		ing     *v1alpha1.Ingress
+		probe   *config.ProbeConfig
 		objects []runtime.Object
 		want    []status.ProbeTarget
 		wantErr error
 	}{{
 		name: "single address to probe",
 		objects: []runtime.Object{
-			privateEndpointsOneAddr,
+			public(privateEndpointsOneAddr),
 		},
 		ing: ing(withBasicSpec, withGatewayAPIClass),
 		want: []status.ProbeTarget{
@@ -72,18 +79,18 @@ func TestListProbeTargets(t *testing.T) {
 		name:    "no endpoint to probe",
 		objects: []runtime.Object{},
 		ing:     ing(withBasicSpec, withGatewayAPIClass),
-		wantErr: fmt.Errorf("failed to get internal service: endpoints %q not found", "knative-local-gateway"),
+		wantErr: fmt.Errorf("no EndpointSlices found for gateway service %q", "istio-system/istio-ingressgateway"),
 	}, {
 		name: "endpoint without address to probe",
 		objects: []runtime.Object{
-			privateEndpointsNoAddr,
+			public(privateEndpointsNoAddr),
 		},
 		ing:     ing(withBasicSpec, withGatewayAPIClass),
-		wantErr: fmt.Errorf("no gateway pods available"),
+		wantErr: fmt.Errorf("no gateway pods available for service %q", "istio-system/istio-ingressgateway"),
 	}, {
 		name: "endpoint with single address to probe (https redirected)",
 		objects: []runtime.Object{
-			privateEndpointsOneAddr,
+			public(privateEndpointsOneAddr),
 		},
 		ing: ing(withBasicSpec, withGatewayAPIClass, withHTTPOption(v1alpha1.HTTPOptionRedirected)),
 		want: []status.ProbeTarget{{
@@ -96,11 +103,61 @@ func TestListProbeTargets(t *testing.T) {
 			}},
 		}},
 	}, {
-		name: "endpoint with multiple addresses and subsets to probe",
+		name: "endpoint with multiple addresses and slices to probe",
+		objects: []runtime.Object{
+			public(privateEndpointsMultiAddr),
+			public(privateEndpointsOtherSlice),
+		},
+		ing: ing(withBasicSpec, withGatewayAPIClass),
+		want: []status.ProbeTarget{{
+			PodIPs:  sets.NewString("2.3.4.5", "3.4.5.6", "4.3.2.1"),
+			PodPort: "8080",
+			URLs: []*url.URL{{
+				Scheme: "http",
+				Host:   "example.com",
+				Path:   "/",
+			}},
+		}},
+	}, {
+		name: "only ready endpoints which are not terminating are probed",
 		objects: []runtime.Object{
-			privateEndpointsMultiAddrMultiSubset,
+			public(privateEndpointsConditions),
 		},
 		ing: ing(withBasicSpec, withGatewayAPIClass),
+		want: []status.ProbeTarget{{
+			PodIPs:  sets.NewString("1.1.1.1", "2.2.2.2"),
+			PodPort: "8080",
+			URLs: []*url.URL{{
+				Scheme: "http",
+				Host:   "example.com",
+				Path:   "/",
+			}},
+		}},
+	}, {
+		name: "both families of dual-stack are probed",
+		objects: []runtime.Object{
+			public(privateEndpointsOneAddr),
+			public(privateEndpointsIPv6),
+			public(privateEndpointsFQDN),
+		},
+		ing: ing(withBasicSpec, withGatewayAPIClass),
+		want: []status.ProbeTarget{{
+			PodIPs:  sets.NewString("1.2.3.4", "2001:db8::1"),
+			PodPort: "8080",
+			URLs: []*url.URL{{
+				Scheme: "http",
+				Host:   "example.com",
+				Path:   "/",
+			}},
+		}},
+	}, {
+		name: "cluster local rule is probed through the local gateway",
+		objects: []runtime.Object{
+			privateEndpointsOneAddr,
+			public(privateEndpointsMultiAddr),
+			public(privateEndpointsOtherSlice),
+		},
+		ing: ing(withBasicSpec, withLocalRule, withGatewayAPIClass),
 		want: []status.ProbeTarget{{
 			PodIPs:  sets.NewString("2.3.4.5", "3.4.5.6", "4.3.2.1"),
 			PodPort: "8080",
@@ -109,6 +166,94 @@ func TestListProbeTargets(t *testing.T) {
 				Host:   "example.com",
 				Path:   "/",
 			}},
+		}, {
+			PodIPs:  sets.NewString("1.2.3.4"),
+			PodPort: "8081",
+			URLs: []*url.URL{{
+				Scheme: "http",
+				Host:   "name.ns.svc.cluster.local",
+				Path:   "/",
+			}},
+		}},
+	}, {
+		name: "external gateway without pods",
+		objects: []runtime.Object{
+			privateEndpointsOneAddr,
+			public(privateEndpointsNoAddr),
+		},
+		ing:     ing(withBasicSpec, withLocalRule, withGatewayAPIClass),
+		wantErr: fmt.Errorf("no gateway pods available for service %q", "istio-system/istio-ingressgateway"),
+	}, {
+		name: "configured ports",
+		objects: []runtime.Object{
+			public(privateEndpointsOneAddr),
+			gateway("knative-gateway", withListener(gatewayv1alpha1.HTTPProtocolType, 80)),
+			service("istio-ingressgateway", withServicePort("http", 80, intstr.FromInt(8888))),
+		},
+		probe: &config.ProbeConfig{HTTPPort: 8000},
+		ing:   ing(withBasicSpec, withGatewayAPIClass),
+		want: []status.ProbeTarget{{
+			PodIPs:  sets.NewString("1.2.3.4"),
+			PodPort: "8000",
+			URLs: []*url.URL{{
+				Scheme: "http",
+				Host:   "example.com",
+				Path:   "/",
+			}},
+		}},
+	}, {
+		name: "configured scheme",
+		objects: []runtime.Object{
+			public(privateEndpointsOneAddr),
+		},
+		probe: &config.ProbeConfig{Scheme: "http", HTTPPort: 8000},
+		ing:   ing(withBasicSpec, withGatewayAPIClass, withHTTPOption(v1alpha1.HTTPOptionRedirected)),
+		want: []status.ProbeTarget{{
+			PodIPs:  sets.NewString("1.2.3.4"),
+			PodPort: "8000",
+			URLs: []*url.URL{{
+				Scheme: "http",
+				Host:   "example.com",
+				Path:   "/",
+			}},
+		}},
+	}, {
+		name: "port derived from the targetPort of the listener",
+		objects: []runtime.Object{
+			public(privateEndpointsOneAddr),
+			gateway("knative-gateway", withListener(gatewayv1alpha1.HTTPProtocolType, 80)),
+			service("istio-ingressgateway", withServicePort("http", 80, intstr.FromInt(8888))),
+		},
+		ing: ing(withBasicSpec, withGatewayAPIClass),
+		want: []status.ProbeTarget{{
+			PodIPs:  sets.NewString("1.2.3.4"),
+			PodPort: "8888",
+			URLs: []*url.URL{{
+				Scheme: "http",
+				Host:   "example.com",
+				Path:   "/",
+			}},
+		}},
+	}, {
+		name: "port derived from the named targetPort of the HTTPS listener",
+		objects: []runtime.Object{
+			public(privateEndpointsOneAddr),
+			gateway("knative-gateway",
+				withListener(gatewayv1alpha1.HTTPProtocolType, 80),
+				withListener(gatewayv1alpha1.HTTPSProtocolType, 443)),
+			service("istio-ingressgateway",
+				withServicePort("http", 80, intstr.FromInt(8888)),
+				withServicePort("asdf", 443, intstr.FromString("https"))),
+		},
+		ing: ing(withBasicSpec, withGatewayAPIClass, withHTTPOption(v1alpha1.HTTPOptionRedirected)),
+		want: []status.ProbeTarget{{
+			PodIPs:  sets.NewString("1.2.3.4"),
+			PodPort: "8080",
+			URLs: []*url.URL{{
+				Scheme: "https",
+				Host:   "example.com",
+				Path:   "/",
+			}},
 		}},
 	}}
 
@@ -117,10 +262,13 @@ func TestListProbeTargets(t *testing.T) {
 			tl := NewListers(test.objects)
 
 			l := &gatewayPodTargetLister{
-				endpointsLister: tl.GetEndpointsLister(),
+				endpointSliceLister: tl.GetEndpointSliceLister(),
+				gatewayLister:       tl.GetGatewayLister(),
+				serviceLister:       tl.GetServiceLister(),
 			}
 
 			cfg := defaultConfig.DeepCopy()
+			cfg.Gateway.Gateways[v1alpha1.IngressVisibilityExternalIP].Probe = test.probe
 			ctx := (&testConfigStore{config: cfg}).ToContext(context.Background())
 
 			got, gotErr := l.ListProbeTargets(ctx, test.ing)
@@ -138,59 +286,71 @@ func TestListProbeTargets(t *testing.T) {
 }
 
 var (
-	privateEndpointsOneAddr = &corev1.Endpoints{
+	privateEndpointsOneAddr = endpointSlice(privateName+"-ipv4", discoveryv1.AddressTypeIPv4,
+		endpoint("1.2.3.4", nil))
+	privateEndpointsMultiAddr = endpointSlice(privateName+"-a", discoveryv1.AddressTypeIPv4,
+		endpoint("2.3.4.5", nil), endpoint("3.4.5.6", nil))
+	privateEndpointsOtherSlice = endpointSlice(privateName+"-b", discoveryv1.AddressTypeIPv4,
+		endpoint("4.3.2.1", nil))
+	privateEndpointsNoAddr     = endpointSlice(privateName+"-ipv4", discoveryv1.AddressTypeIPv4)
+	privateEndpointsConditions = endpointSlice(privateName+"-ipv4", discoveryv1.AddressTypeIPv4,
+		endpoint("1.1.1.1", &discoveryv1.EndpointConditions{Ready: ptr.Bool(true)}),
+		endpoint("2.2.2.2", &discoveryv1.EndpointConditions{}),
+		endpoint("3.3.3.3", &discoveryv1.EndpointConditions{Ready: ptr.Bool(false)}),
+		endpoint("4.4.4.4", &discoveryv1.EndpointConditions{
+			Ready:       ptr.Bool(false),
+			Serving:     ptr.Bool(true),
+			Terminating: ptr.Bool(true),
+		}))
+	privateEndpointsIPv6 = endpointSlice(privateName+"-ipv6", discoveryv1.AddressTypeIPv6,
+		endpoint("2001:db8::1", nil))
+	privateEndpointsFQDN = endpointSlice(privateName+"-fqdn", discoveryv1.AddressTypeFQDN,
+		endpoint("gateway.example.com", nil))
+)
+
+func endpointSlice(name string, addressType discoveryv1.AddressType, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+	return &discoveryv1.EndpointSlice{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: privateNS,
-			Name:      privateName,
+			Name:      name,
+			Labels:    map[string]string{discoveryv1.LabelServiceName: privateName},
 		},
-		Subsets: []corev1.EndpointSubset{{
-			Ports: []corev1.EndpointPort{{
-				Name: "asdf",
-				Port: 8080,
-			}},
-			Addresses: []corev1.EndpointAddress{{
-				IP: "1.2.3.4",
-			}},
+		AddressType: addressType,
+		Ports: []discoveryv1.EndpointPort{{
+			Name: ptr.String("asdf"),
+			Port: ptr.Int32(8080),
 		}},
+		Endpoints: endpoints,
 	}
-	privateEndpointsMultiAddrMultiSubset = &corev1.Endpoints{
-		ObjectMeta: metav1.ObjectMeta{
-			Namespace: privateNS,
-			Name:      privateName,
-		},
-		Subsets: []corev1.EndpointSubset{{
-			Ports: []corev1.EndpointPort{{
-				Name: "asdf",
-				Port: 1234,
-			}},
-			Addresses: []corev1.EndpointAddress{{
-				IP: "2.3.4.5",
-			}},
-		}, {
-			Ports: []corev1.EndpointPort{{
-				Name: "asdf",
-				Port: 4321,
-			}},
-			Addresses: []corev1.EndpointAddress{{
-				IP: "3.4.5.6",
-			}, {
-				IP: "4.3.2.1",
-			}},
-		}},
+}
+
+func endpoint(address string, conditions *discoveryv1.EndpointConditions) discoveryv1.Endpoint {
+	ep := discoveryv1.Endpoint{Addresses: []string{address}}
+	if conditions != nil {
+		ep.Conditions = *conditions
+	} else {
+		ep.Conditions.Ready = ptr.Bool(true)
 	}
-	privateEndpointsNoAddr = &corev1.Endpoints{
-		ObjectMeta: metav1.ObjectMeta{
-			Namespace: privateNS,
-			Name:      privateName,
-		},
-		Subsets: []corev1.EndpointSubset{{
-			Ports: []corev1.EndpointPort{{
-				Name: "fdsa",
-				Port: 32,
-			}},
-		}},
+	return ep
+}
+
+func withServicePort(name string, port int32, targetPort intstr.IntOrString) func(*corev1.Service) {
+	return func(svc *corev1.Service) {
+		svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{
+			Name:       name,
+			Port:       port,
+			TargetPort: targetPort,
+		})
 	}
-)
+}
+
+// public returns the copy of the EndpointSlice for the external gateway service.
+func public(slice *discoveryv1.EndpointSlice) *discoveryv1.EndpointSlice {
+	slice = slice.DeepCopy()
+	slice.Name = strings.Replace(slice.Name, privateName, publicName, 1)
+	slice.Labels[discoveryv1.LabelServiceName] = publicName
+	return slice
+}
 
 func withBasicSpec(i *v1alpha1.Ingress) {
 	i.Spec = v1alpha1.IngressSpec{
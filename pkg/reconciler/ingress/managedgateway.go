@@ -0,0 +1,187 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingress
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+
+	"knative.dev/networking/pkg/apis/networking"
+	"knative.dev/networking/pkg/apis/networking/v1alpha1"
+	ingressinformer "knative.dev/networking/pkg/client/injection/informers/networking/v1alpha1/ingress"
+	kubeclient "knative.dev/pkg/client/injection/kube/client"
+	namespaceinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/namespace"
+	secretinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/secret/filtered"
+	"knative.dev/pkg/configmap"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/kmeta"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/reconciler"
+
+	gwapiclient "github.com/nak3/net-gateway-api/pkg/client/gatewayapi/injection/client"
+	gatewayinformer "github.com/nak3/net-gateway-api/pkg/client/gatewayapi/injection/informers/apis/v1alpha1/gateway"
+	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/config"
+)
+
+// managedGatewaysKey is the single work item of the managed Gateways, as their
+// listeners are built from all the Ingresses at once.
+var managedGatewaysKey = types.NamespacedName{Name: "managed-gateways"}
+
+// managedGatewayReconciler reconciles the Gateways managed by the controller
+// through a work queue of its own, so that the failures are retried.
+type managedGatewayReconciler struct {
+	reconciler.LeaderAwareFuncs
+	*Reconciler
+
+	configStore *config.Store
+}
+
+// Check that our Reconciler implements controller.Reconciler.
+var _ controller.Reconciler = (*managedGatewayReconciler)(nil)
+
+// Check that our Reconciler is LeaderAware, so that only the leader updates
+// the shared Gateways.
+var _ reconciler.LeaderAware = (*managedGatewayReconciler)(nil)
+
+// NewManagedGatewayController initializes the controller of the managed
+// Gateways and registers the event handlers which enqueue their work item.
+func NewManagedGatewayController(
+	ctx context.Context,
+	cmw configmap.Watcher,
+) *controller.Impl {
+	logger := logging.FromContext(ctx)
+
+	ingressInformer := ingressinformer.Get(ctx)
+	gatewayInformer := gatewayinformer.Get(ctx)
+	namespaceInformer := namespaceinformer.Get(ctx)
+	secretInformer := secretinformer.Get(ctx, networking.OriginSecretNameLabelKey)
+	certificateSecretInformer := secretinformer.Get(ctx, certificateUIDLabelKey)
+
+	r := &managedGatewayReconciler{
+		Reconciler: &Reconciler{
+			kubeclient:              kubeclient.Get(ctx),
+			gwapiclient:             gwapiclient.Get(ctx),
+			ingressLister:           ingressInformer.Lister(),
+			gatewayLister:           gatewayInformer.Lister(),
+			namespaceLister:         namespaceInformer.Lister(),
+			secretLister:            secretInformer.Lister(),
+			certificateSecretLister: certificateSecretInformer.Lister(),
+		},
+	}
+	impl := controller.NewContext(ctx, r, controller.ControllerOptions{
+		WorkQueueName: "ManagedGateway",
+		Logger:        logger.Named("managed-gateway"),
+	})
+	r.PromoteFunc = func(bkt reconciler.Bucket, enq func(reconciler.Bucket, types.NamespacedName)) error {
+		enq(bkt, managedGatewaysKey)
+		return nil
+	}
+
+	r.configStore = config.NewStore(logging.WithLogger(ctx, logger.Named("config-store")),
+		configmap.TypeFilter(&config.Gateway{})(func(string, interface{}) {
+			impl.EnqueueKey(managedGatewaysKey)
+		}))
+	r.configStore.WatchConfigs(cmw)
+
+	// All the changes are coalesced into the single work item, which is not
+	// enqueued at all unless some Gateway is managed.
+	enqueue := func(interface{}) {
+		if hasManagedGateway(r.configStore.Load().Gateway) {
+			impl.EnqueueKey(managedGatewaysKey)
+		}
+	}
+
+	logger.Info("Setting up managed Gateway event handlers")
+	// The TLS listeners follow the Ingresses, and are dropped with the last
+	// Ingress using them.
+	ingressInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			ing, ok := obj.(*v1alpha1.Ingress)
+			return ok && ingressClassFilter(ing)
+		},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc: enqueue,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				// The status updates of the Ingresses change no listener.
+				oldIng, newIng := oldObj.(*v1alpha1.Ingress), newObj.(*v1alpha1.Ingress)
+				if !equality.Semantic.DeepEqual(oldIng.Spec, newIng.Spec) ||
+					!equality.Semantic.DeepEqual(oldIng.Annotations, newIng.Annotations) ||
+					(oldIng.DeletionTimestamp == nil) != (newIng.DeletionTimestamp == nil) {
+					enqueue(newObj)
+				}
+			},
+			DeleteFunc: enqueue,
+		},
+	})
+	// The gateway selectors follow the labels of the namespaces.
+	namespaceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNs, newNs := oldObj.(*corev1.Namespace), newObj.(*corev1.Namespace)
+			if !equality.Semantic.DeepEqual(oldNs.Labels, newNs.Labels) {
+				enqueue(newObj)
+			}
+		},
+	})
+	// The managed Gateways and the copies of the TLS secrets are restored when
+	// they are modified or deleted by hand.
+	gatewayInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: isManagedObject,
+		Handler:    controller.HandleAll(enqueue),
+	})
+	secretInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: isManagedObject,
+		Handler:    controller.HandleAll(enqueue),
+	})
+	// The copies of the TLS secrets follow the secrets of the Knative
+	// Certificates.
+	certificateSecretInformer.Informer().AddEventHandler(controller.HandleAll(enqueue))
+
+	return impl
+}
+
+// Reconcile implements controller.Reconciler.
+func (r *managedGatewayReconciler) Reconcile(ctx context.Context, key string) error {
+	if !r.IsLeaderFor(managedGatewaysKey) {
+		return controller.NewSkipKey(key)
+	}
+	return r.reconcileManagedGateways(r.configStore.ToContext(ctx))
+}
+
+// hasManagedGateway returns true if the Gateway of any visibility is managed by
+// the controller.
+func hasManagedGateway(gatewayConfig *config.Gateway) bool {
+	for _, visibility := range visibilities {
+		if gatewayConfig.LookupManagedGateway(visibility) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// isManagedObject returns true if the object, or the final state of the
+// deleted object, is provisioned by the controller for the managed Gateways.
+func isManagedObject(obj interface{}) bool {
+	object, err := kmeta.DeletionHandlingAccessor(obj)
+	return err == nil && isManaged(object)
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingress
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	gatewayv1alpha1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
+
+	"knative.dev/networking/pkg/apis/networking/v1alpha1"
+	"knative.dev/networking/pkg/status"
+
+	gwlisters "github.com/nak3/net-gateway-api/pkg/client/gatewayapi/listers/apis/v1alpha1"
+	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/config"
+)
+
+const (
+	// HTTPPortGateway is the default port of the HTTP listener of the Gateway.
+	HTTPPortGateway = "80"
+	// HTTPSPortGateway is the default port of the HTTPS listener of the Gateway.
+	HTTPSPortGateway = "443"
+)
+
+// probedReadiness is the readiness strategies which are verified by probing,
+// in the order of the probe targets.
+var probedReadiness = []config.ReadinessStrategy{
+	config.ReadinessPodProbe,
+	config.ReadinessGatewayProbe,
+}
+
+// readinessTargetLister lists the probe targets of each rule with the lister
+// of the readiness strategy configured for the rule visibility. The rules
+// verified by the conditions have no probe targets.
+type readinessTargetLister struct {
+	listers map[config.ReadinessStrategy]status.ProbeTargetLister
+}
+
+func (l *readinessTargetLister) ListProbeTargets(ctx context.Context, ing *v1alpha1.Ingress) ([]status.ProbeTarget, error) {
+	gatewayConfig := config.FromContext(ctx).Gateway
+
+	var targets []status.ProbeTarget
+	for _, strategy := range probedReadiness {
+		var rules []v1alpha1.IngressRule
+		for _, rule := range ing.Spec.Rules {
+			if gatewayConfig.LookupReadiness(rule.Visibility) == strategy {
+				rules = append(rules, rule)
+			}
+		}
+		if len(rules) == 0 {
+			continue
+		}
+
+		// Let the lister see only the rules it is responsible for.
+		sub := ing.DeepCopy()
+		sub.Spec.Rules = rules
+		t, err := l.listers[strategy].ListProbeTargets(ctx, sub)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, t...)
+	}
+	return targets, nil
+}
+
+// gatewayAddressTargetLister probes the addresses of the Gateway through its
+// listeners.
+type gatewayAddressTargetLister struct {
+	gatewayLister gwlisters.GatewayLister
+	serviceLister corev1listers.ServiceLister
+}
+
+func (l *gatewayAddressTargetLister) ListProbeTargets(ctx context.Context, ing *v1alpha1.Ingress) ([]status.ProbeTarget, error) {
+	gatewayConfig := config.FromContext(ctx).Gateway
+	namespaceLabels := config.NamespaceLabelsFromContext(ctx)
+
+	targets := make([]status.ProbeTarget, 0, len(ing.Spec.Rules))
+	for _, rule := range ing.Spec.Rules {
+		// Each rule is probed through every gateway of its visibility.
+		services := gatewayConfig.LookupServicesFor(ing, namespaceLabels, rule.Visibility)
+		for i, key := range gatewayConfig.LookupGatewaysFor(ing, namespaceLabels, rule.Visibility) {
+			target, err := l.probeTarget(gatewayConfig.LookupProbeScheme(ing, rule.Visibility), &rule, key, services[i])
+			if err != nil {
+				return nil, err
+			}
+			targets = append(targets, target)
+		}
+	}
+	return targets, nil
+}
+
+// probeTarget returns the probe target of the rule with the scheme through the
+// addresses of the Gateway with the given key and service.
+func (l *gatewayAddressTargetLister) probeTarget(scheme string, rule *v1alpha1.IngressRule,
+	key, svcKey string) (status.ProbeTarget, error) {
+	gw, err := getGateway(l.gatewayLister, key)
+	if err != nil {
+		return status.ProbeTarget{}, err
+	}
+	addresses, err := lookupGatewayAddresses(gw, l.serviceLister, svcKey)
+	if err != nil {
+		return status.ProbeTarget{}, err
+	}
+
+	ips := sets.NewString()
+	for _, addr := range addresses {
+		if addr.IP != "" {
+			ips.Insert(addr.IP)
+		} else if addr.Domain != "" {
+			ips.Insert(addr.Domain)
+		}
+	}
+	if ips.Len() == 0 {
+		return status.ProbeTarget{}, fmt.Errorf("no addresses available for Gateway %q", key)
+	}
+
+	protocol, port := gatewayv1alpha1.HTTPProtocolType, HTTPPortGateway
+	if scheme == "https" {
+		protocol, port = gatewayv1alpha1.HTTPSProtocolType, HTTPSPortGateway
+	}
+	if gw != nil {
+		for _, listener := range gw.Spec.Listeners {
+			if listener.Protocol == protocol {
+				port = strconv.Itoa(int(listener.Port))
+				break
+			}
+		}
+	}
+
+	return status.ProbeTarget{
+		PodIPs:  ips,
+		PodPort: port,
+		URLs:    domainsToURL(rule.Hosts, scheme),
+	}, nil
+}
+
+// gatewayConditionManager verifies the readiness of the rules whose visibility
+// trusts the conditions by the Ready condition of the quorum of its Gateways,
+// and the rest of the rules by the underlying Manager.
+type gatewayConditionManager struct {
+	status.Manager
+
+	gatewayLister gwlisters.GatewayLister
+}
+
+// IsReady implements status.Manager.
+func (m *gatewayConditionManager) IsReady(ctx context.Context, ing *v1alpha1.Ingress) (bool, error) {
+	gatewayConfig := config.FromContext(ctx).Gateway
+	namespaceLabels := config.NamespaceLabelsFromContext(ctx)
+
+	for _, rule := range ing.Spec.Rules {
+		if gatewayConfig.LookupReadiness(rule.Visibility) != config.ReadinessConditions {
+			continue
+		}
+		// The admission of the HTTPRoutes is verified by NetworkConfigured.
+		ready := 0
+		for _, key := range gatewayConfig.LookupGatewaysFor(ing, namespaceLabels, rule.Visibility) {
+			gw, err := getGateway(m.gatewayLister, key)
+			if err != nil {
+				return false, err
+			}
+			if gw != nil && isGatewayReady(gw) {
+				ready++
+			}
+		}
+		if ready < gatewayConfig.LookupQuorum(rule.Visibility) {
+			return false, nil
+		}
+	}
+	return m.Manager.IsReady(ctx, ing)
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingress
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	gatewayv1alpha1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
+
+	"knative.dev/networking/pkg/apis/networking/v1alpha1"
+	"knative.dev/networking/pkg/status"
+
+	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/config"
+	. "github.com/nak3/net-gateway-api/pkg/reconciler/testing"
+)
+
+func TestReadinessListProbeTargets(t *testing.T) {
+	tests := []struct {
+		name      string
+		readiness map[v1alpha1.IngressVisibility]config.ReadinessStrategy
+		ing       *v1alpha1.Ingress
+		objects   []runtime.Object
+		want      []status.ProbeTarget
+		wantErr   bool
+	}{{
+		name: "pod probe by default",
+		ing:  ing(withBasicSpec, withGatewayAPIClass),
+		objects: []runtime.Object{
+			public(privateEndpointsOneAddr),
+		},
+		want: []status.ProbeTarget{{
+			PodIPs:  sets.NewString("1.2.3.4"),
+			PodPort: "8080",
+			URLs:    []*url.URL{{Scheme: "http", Host: "example.com", Path: "/"}},
+		}},
+	}, {
+		name: "gateway probe",
+		readiness: map[v1alpha1.IngressVisibility]config.ReadinessStrategy{
+			v1alpha1.IngressVisibilityExternalIP: config.ReadinessGatewayProbe,
+		},
+		ing: ing(withBasicSpec, withGatewayAPIClass),
+		objects: []runtime.Object{
+			gateway("knative-gateway", withGatewayAddress("1.2.3.4")),
+		},
+		want: []status.ProbeTarget{{
+			PodIPs:  sets.NewString("1.2.3.4"),
+			PodPort: "80",
+			URLs:    []*url.URL{{Scheme: "http", Host: "example.com", Path: "/"}},
+		}},
+	}, {
+		name: "gateway probe through the HTTPS listener",
+		readiness: map[v1alpha1.IngressVisibility]config.ReadinessStrategy{
+			v1alpha1.IngressVisibilityExternalIP: config.ReadinessGatewayProbe,
+		},
+		ing: ing(withBasicSpec, withGatewayAPIClass, withHTTPOption(v1alpha1.HTTPOptionRedirected)),
+		objects: []runtime.Object{
+			gateway("knative-gateway", withGatewayAddress("1.2.3.4"),
+				withListener(gatewayv1alpha1.HTTPProtocolType, 8000),
+				withListener(gatewayv1alpha1.HTTPSProtocolType, 8443)),
+		},
+		want: []status.ProbeTarget{{
+			PodIPs:  sets.NewString("1.2.3.4"),
+			PodPort: "8443",
+			URLs:    []*url.URL{{Scheme: "https", Host: "example.com", Path: "/"}},
+		}},
+	}, {
+		name: "gateway probe through the service load balancer",
+		readiness: map[v1alpha1.IngressVisibility]config.ReadinessStrategy{
+			v1alpha1.IngressVisibilityExternalIP: config.ReadinessGatewayProbe,
+		},
+		ing: ing(withBasicSpec, withGatewayAPIClass),
+		objects: []runtime.Object{
+			service("istio-ingressgateway", withLoadBalancerHostname("lb.example.com")),
+		},
+		want: []status.ProbeTarget{{
+			PodIPs:  sets.NewString("lb.example.com"),
+			PodPort: "80",
+			URLs:    []*url.URL{{Scheme: "http", Host: "example.com", Path: "/"}},
+		}},
+	}, {
+		name: "gateway probe without addresses",
+		readiness: map[v1alpha1.IngressVisibility]config.ReadinessStrategy{
+			v1alpha1.IngressVisibilityExternalIP: config.ReadinessGatewayProbe,
+		},
+		ing: ing(withBasicSpec, withGatewayAPIClass),
+		objects: []runtime.Object{
+			gateway("knative-gateway"),
+		},
+		wantErr: true,
+	}, {
+		name: "conditions do not probe",
+		readiness: map[v1alpha1.IngressVisibility]config.ReadinessStrategy{
+			v1alpha1.IngressVisibilityExternalIP: config.ReadinessConditions,
+		},
+		ing: ing(withBasicSpec, withGatewayAPIClass),
+	}, {
+		name: "mixed strategies",
+		readiness: map[v1alpha1.IngressVisibility]config.ReadinessStrategy{
+			v1alpha1.IngressVisibilityExternalIP: config.ReadinessGatewayProbe,
+		},
+		ing: ing(withBasicSpec, withLocalRule, withGatewayAPIClass),
+		objects: []runtime.Object{
+			privateEndpointsOneAddr,
+			gateway("knative-gateway", withGatewayAddress("5.6.7.8")),
+		},
+		want: []status.ProbeTarget{{
+			PodIPs:  sets.NewString("1.2.3.4"),
+			PodPort: "8081",
+			URLs:    []*url.URL{{Scheme: "http", Host: "name.ns.svc.cluster.local", Path: "/"}},
+		}, {
+			PodIPs:  sets.NewString("5.6.7.8"),
+			PodPort: "80",
+			URLs:    []*url.URL{{Scheme: "http", Host: "example.com", Path: "/"}},
+		}},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tl := NewListers(test.objects)
+			l := NewProbeTargetLister(nil, tl.GetEndpointSliceLister(), tl.GetGatewayLister(), tl.GetServiceLister())
+
+			cfg := defaultConfig.DeepCopy()
+			for visibility, readiness := range test.readiness {
+				cfg.Gateway.Gateways[visibility].Readiness = readiness
+			}
+			ctx := (&testConfigStore{config: cfg}).ToContext(context.Background())
+
+			got, err := l.ListProbeTargets(ctx, test.ing)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ListProbeTargets() = %v, wantErr %v", err, test.wantErr)
+			}
+			if !cmp.Equal(test.want, got) {
+				t.Error("ListProbeTargets (-want, +got) =", cmp.Diff(test.want, got))
+			}
+		})
+	}
+}
+
+func TestGatewayConditionManager(t *testing.T) {
+	tests := []struct {
+		name       string
+		readiness  config.ReadinessStrategy
+		additional []config.AdditionalGateway
+		quorum     int
+		objects    []runtime.Object
+		probed     bool
+		want       bool
+	}{{
+		name:   "probed",
+		probed: true,
+		want:   true,
+	}, {
+		name:      "gateway is ready",
+		readiness: config.ReadinessConditions,
+		objects: []runtime.Object{
+			gateway("knative-gateway", withGatewayReady(metav1.ConditionTrue)),
+		},
+		want: true,
+	}, {
+		name:      "gateway is not ready",
+		readiness: config.ReadinessConditions,
+		objects: []runtime.Object{
+			gateway("knative-gateway", withGatewayReady(metav1.ConditionFalse)),
+		},
+	}, {
+		name:      "gateway does not exist",
+		readiness: config.ReadinessConditions,
+	}, {
+		name:       "additional gateway does not exist",
+		readiness:  config.ReadinessConditions,
+		additional: []config.AdditionalGateway{{Gateway: "istio-system/vpn-gateway", Service: "istio-system/vpn"}},
+		objects: []runtime.Object{
+			gateway("knative-gateway", withGatewayReady(metav1.ConditionTrue)),
+		},
+	}, {
+		name:       "quorum of gateways is ready",
+		readiness:  config.ReadinessConditions,
+		additional: []config.AdditionalGateway{{Gateway: "istio-system/vpn-gateway", Service: "istio-system/vpn"}},
+		quorum:     1,
+		objects: []runtime.Object{
+			gateway("knative-gateway", withGatewayReady(metav1.ConditionFalse)),
+			gateway("vpn-gateway", withGatewayReady(metav1.ConditionTrue)),
+		},
+		want: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tl := NewListers(test.objects)
+			probed := false
+			m := &gatewayConditionManager{
+				Manager: &fakeStatusManager{
+					FakeIsReady: func(context.Context, *v1alpha1.Ingress) (bool, error) {
+						probed = true
+						return true, nil
+					},
+				},
+				gatewayLister: tl.GetGatewayLister(),
+			}
+
+			cfg := defaultConfig.DeepCopy()
+			cfg.Gateway.Gateways[v1alpha1.IngressVisibilityExternalIP].Readiness = test.readiness
+			cfg.Gateway.Gateways[v1alpha1.IngressVisibilityExternalIP].AdditionalGateways = test.additional
+			cfg.Gateway.Gateways[v1alpha1.IngressVisibilityExternalIP].Quorum = test.quorum
+			ctx := (&testConfigStore{config: cfg}).ToContext(context.Background())
+
+			got, err := m.IsReady(ctx, ing(withBasicSpec, withGatewayAPIClass))
+			if err != nil {
+				t.Fatal("IsReady() =", err)
+			}
+			if got != test.want {
+				t.Errorf("IsReady() = %v, want %v", got, test.want)
+			}
+			if probed != test.want {
+				t.Errorf("probed = %v, want %v", probed, test.want)
+			}
+		})
+	}
+}
+
+func withListener(protocol gatewayv1alpha1.ProtocolType, port int) func(*gatewayv1alpha1.Gateway) {
+	return func(gw *gatewayv1alpha1.Gateway) {
+		gw.Spec.Listeners = append(gw.Spec.Listeners, gatewayv1alpha1.Listener{
+			Protocol: protocol,
+			Port:     gatewayv1alpha1.PortNumber(port),
+		})
+	}
+}
+
+func withGatewayReady(s metav1.ConditionStatus) func(*gatewayv1alpha1.Gateway) {
+	return func(gw *gatewayv1alpha1.Gateway) {
+		gw.Status.Conditions = append(gw.Status.Conditions, metav1.Condition{
+			Type:   string(gatewayv1alpha1.GatewayConditionReady),
+			Status: s,
+		})
+	}
+}
@@ -24,28 +24,29 @@ import (
 	"k8s.io/apimachinery/pkg/api/equality"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
 	gwv1alpha1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
 
+	"knative.dev/networking/pkg/apis/networking"
 	netv1alpha1 "knative.dev/networking/pkg/apis/networking/v1alpha1"
 	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/tracker"
 
-	//	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/config"
+	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/config"
 	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/resources"
 )
 
 // reconcileHTTPRoute reconciles HTTPRoute.
 func (c *Reconciler) reconcileHTTPRoute(
 	ctx context.Context, ing *netv1alpha1.Ingress,
-	rule *netv1alpha1.IngressRule,
+	desired *gwv1alpha1.HTTPRoute,
 ) (*gwv1alpha1.HTTPRoute, error) {
 	recorder := controller.GetEventRecorder(ctx)
 
-	httproute, err := c.httprouteLister.HTTPRoutes(ing.Namespace).Get(resources.LongestHost(rule.Hosts))
+	httproute, err := c.httprouteLister.HTTPRoutes(desired.Namespace).Get(desired.Name)
 	if apierrs.IsNotFound(err) {
-		desired, err := resources.MakeHTTPRoute(ctx, ing, rule)
-		if err != nil {
-			return nil, err
-		}
 		httproute, err = c.gwapiclient.NetworkingV1alpha1().HTTPRoutes(desired.Namespace).Create(ctx, desired, metav1.CreateOptions{})
 		if err != nil {
 			recorder.Eventf(ing, corev1.EventTypeWarning, "CreationFailed", "Failed to create HTTPRoute: %v", err)
@@ -56,30 +57,352 @@ func (c *Reconciler) reconcileHTTPRoute(
 		return httproute, nil
 	} else if err != nil {
 		return nil, err
-	} else {
-		desired, err := resources.MakeHTTPRoute(ctx, ing, rule)
+	} else if !metav1.IsControlledBy(httproute, ing) {
+		return nil, markNotOwned(ing, "HTTPRoute", httproute)
+	} else if !equality.Semantic.DeepEqual(httproute.Spec, desired.Spec) ||
+		!equality.Semantic.DeepEqual(httproute.Annotations, desired.Annotations) ||
+		!equality.Semantic.DeepEqual(httproute.Labels, desired.Labels) {
+
+		// Don't modify the informers copy.
+		origin := httproute.DeepCopy()
+		origin.Spec = desired.Spec
+		origin.Annotations = desired.Annotations
+		origin.Labels = desired.Labels
+
+		updated, err := c.gwapiclient.NetworkingV1alpha1().HTTPRoutes(origin.Namespace).Update(
+			ctx, origin, metav1.UpdateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to update HTTPRoute: %w", err)
+		}
+		return updated, nil
+	}
+
+	return httproute, nil
+}
+
+// deleteStaleHTTPRoutes deletes the HTTPRoutes owned by the Ingress which are
+// no longer generated from its rules.
+func (c *Reconciler) deleteStaleHTTPRoutes(
+	ctx context.Context, ing *netv1alpha1.Ingress,
+	desired sets.String,
+) error {
+	recorder := controller.GetEventRecorder(ctx)
+
+	// The routes created by older versions don't carry the Ingress label,
+	// so look them up by their owner reference.
+	httproutes, err := c.httprouteLister.HTTPRoutes(ing.Namespace).List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list HTTPRoutes: %w", err)
+	}
+
+	for _, httproute := range httproutes {
+		if desired.Has(httproute.Name) || !metav1.IsControlledBy(httproute, ing) {
+			continue
+		}
+		if err := c.gwapiclient.NetworkingV1alpha1().HTTPRoutes(httproute.Namespace).Delete(
+			ctx, httproute.Name, metav1.DeleteOptions{}); err != nil && !apierrs.IsNotFound(err) {
+			recorder.Eventf(ing, corev1.EventTypeWarning, "DeleteFailed", "Failed to delete HTTPRoute %q: %v", httproute.Name, err)
+			return fmt.Errorf("failed to delete HTTPRoute: %w", err)
+		}
+		recorder.Eventf(ing, corev1.EventTypeNormal, "Deleted", "Deleted HTTPRoute %q", httproute.Name)
+	}
+	return nil
+}
+
+// reconcileSecret copies the TLS secret into the Ingress namespace when it
+// lives in another namespace, so that HTTPRoutes can reference it.
+func (c *Reconciler) reconcileSecret(
+	ctx context.Context, ing *netv1alpha1.Ingress,
+	tls *netv1alpha1.IngressTLS,
+) error {
+	if tls.SecretNamespace == "" || tls.SecretNamespace == ing.Namespace {
+		return nil
+	}
+
+	// Track the origin secret so that certificate renewals are propagated.
+	if err := c.tracker.TrackReference(tracker.Reference{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Namespace:  tls.SecretNamespace,
+		Name:       tls.SecretName,
+	}, ing); err != nil {
+		return err
+	}
+
+	origin, err := c.getOriginSecret(ctx, tls.SecretNamespace, tls.SecretName)
+	if err != nil {
+		return fmt.Errorf("failed to get TLS secret %s/%s: %w", tls.SecretNamespace, tls.SecretName, err)
+	}
+	return c.reconcileSecretCopy(ctx, ing, resources.MakeSecret(ing, tls, origin), func(secret metav1.Object) bool {
+		return metav1.IsControlledBy(secret, ing)
+	})
+}
+
+// reconcileSecretCopy creates or updates the copy of a TLS secret. The existing
+// secrets which are not managed by us, as told by managed, are never taken
+// over. The events are recorded on the Ingress unless it is nil.
+func (c *Reconciler) reconcileSecretCopy(
+	ctx context.Context, ing *netv1alpha1.Ingress,
+	desired *corev1.Secret, managed func(metav1.Object) bool,
+) error {
+	recorder := controller.GetEventRecorder(ctx)
+
+	secret, err := c.secretLister.Secrets(desired.Namespace).Get(desired.Name)
+	if apierrs.IsNotFound(err) {
+		secret, err = c.kubeclient.CoreV1().Secrets(desired.Namespace).Create(ctx, desired, metav1.CreateOptions{})
+		if err != nil {
+			if ing != nil {
+				recorder.Eventf(ing, corev1.EventTypeWarning, "CreationFailed", "Failed to create Secret: %v", err)
+			}
+			return fmt.Errorf("failed to create Secret: %w", err)
+		}
+
+		if ing != nil {
+			recorder.Eventf(ing, corev1.EventTypeNormal, "Created", "Created Secret %q", secret.GetName())
+		}
+		return nil
+	} else if err != nil {
+		return err
+	} else if !managed(secret) {
+		if ing == nil {
+			logging.FromContext(ctx).Warnf("Secret %s/%s is not managed by the controller", secret.Namespace, secret.Name)
+			return nil
+		}
+		return markNotOwned(ing, "Secret", secret)
+	} else if !equality.Semantic.DeepEqual(secret.Data, desired.Data) ||
+		!equality.Semantic.DeepEqual(secret.Labels, desired.Labels) {
+
+		// Don't modify the informers copy.
+		origin := secret.DeepCopy()
+		origin.Data = desired.Data
+		origin.Labels = desired.Labels
+
+		if _, err := c.kubeclient.CoreV1().Secrets(origin.Namespace).Update(
+			ctx, origin, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update Secret: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// deleteStaleSecrets deletes the copies of the TLS secrets owned by the Ingress
+// which none of its TLS entries reference anymore.
+func (c *Reconciler) deleteStaleSecrets(
+	ctx context.Context, ing *netv1alpha1.Ingress,
+	desired sets.String,
+) error {
+	recorder := controller.GetEventRecorder(ctx)
+
+	secrets, err := c.secretLister.Secrets(ing.Namespace).List(labels.SelectorFromSet(labels.Set{
+		networking.IngressLabelKey: ing.Name,
+	}))
+	if err != nil {
+		return fmt.Errorf("failed to list Secrets: %w", err)
+	}
+
+	for _, secret := range secrets {
+		if desired.Has(secret.Name) || !metav1.IsControlledBy(secret, ing) {
+			continue
+		}
+		if err := c.kubeclient.CoreV1().Secrets(secret.Namespace).Delete(
+			ctx, secret.Name, metav1.DeleteOptions{}); err != nil && !apierrs.IsNotFound(err) {
+			recorder.Eventf(ing, corev1.EventTypeWarning, "DeleteFailed", "Failed to delete Secret %q: %v", secret.Name, err)
+			return fmt.Errorf("failed to delete Secret: %w", err)
+		}
+		recorder.Eventf(ing, corev1.EventTypeNormal, "Deleted", "Deleted Secret %q", secret.Name)
+	}
+	return nil
+}
+
+// getOriginSecret returns the origin TLS secret. Only the secrets of the
+// Knative Certificates are cached and followed, the others are read from the
+// API server and their changes are not followed, as documented in
+// config-gateway.
+func (c *Reconciler) getOriginSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+	secret, err := c.certificateSecretLister.Secrets(namespace).Get(name)
+	if apierrs.IsNotFound(err) {
+		return c.kubeclient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	}
+	return secret, err
+}
+
+// updateGateway updates the spec of the managed Gateway to the desired one.
+func (c *Reconciler) updateGateway(ctx context.Context, gateway, desired *gwv1alpha1.Gateway) error {
+	if equality.Semantic.DeepEqual(gateway.Spec, desired.Spec) {
+		return nil
+	}
+
+	// Don't modify the informers copy.
+	origin := gateway.DeepCopy()
+	origin.Spec = desired.Spec
+
+	if _, err := c.gwapiclient.NetworkingV1alpha1().Gateways(origin.Namespace).Update(
+		ctx, origin, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update Gateway: %w", err)
+	}
+	return nil
+}
+
+// reconcileManagedGateways provisions the managed Gateways with the TLS
+// listeners of all the Ingresses routed through them, copies their TLS secrets
+// and deletes the copies which none of the listeners reference anymore. It
+// runs in the work queue of the managed Gateways, once for any change of the
+// Ingresses, so that the shared Gateways are not rebuilt by every reconciliation
+// of an Ingress. No events are recorded, as there is no Ingress to record them
+// on.
+func (c *Reconciler) reconcileManagedGateways(ctx context.Context) error {
+	logger := logging.FromContext(ctx)
+	gatewayConfig := config.FromContext(ctx).Gateway
+
+	all, err := c.listIngresses()
+	if err != nil {
+		return err
+	}
+	var managed []*gwv1alpha1.Gateway
+	for _, visibility := range visibilities {
+		if gatewayConfig.LookupManagedGateway(visibility) == nil {
+			continue
+		}
+		ingresses, err := c.gatewayIngresses(gatewayConfig, visibility, all)
+		if err != nil {
+			return err
+		}
+		desired := resources.MakeGateway(ctx, visibility, ingresses)
+
+		gateway, err := c.gatewayLister.Gateways(desired.Namespace).Get(desired.Name)
+		if err != nil && !apierrs.IsNotFound(err) {
+			return err
+		} else if gateway != nil && !isManaged(gateway) {
+			// The Gateways applied by hand are never taken over, the
+			// Ingresses routed through them report the conflict.
+			logger.Warnf("Gateway %s/%s is not managed by the controller", gateway.Namespace, gateway.Name)
+			continue
+		}
+
+		// The secrets are copied first, so that the new listeners find them.
+		if err := c.reconcileGatewaySecrets(ctx, desired, visibility, ingresses); err != nil {
+			return err
+		}
+		if gateway == nil {
+			if _, err := c.gwapiclient.NetworkingV1alpha1().Gateways(desired.Namespace).Create(
+				ctx, desired, metav1.CreateOptions{}); err != nil {
+				return fmt.Errorf("failed to create Gateway: %w", err)
+			}
+		} else if err := c.updateGateway(ctx, gateway, desired); err != nil {
+			return err
+		}
+		managed = append(managed, desired)
+	}
+	return c.deleteStaleGatewaySecrets(ctx, managed)
+}
+
+// gatewayIngresses returns the Ingresses among the given ones which are routed
+// through the Gateway of the visibility.
+func (c *Reconciler) gatewayIngresses(gatewayConfig *config.Gateway, visibility netv1alpha1.IngressVisibility,
+	all []*netv1alpha1.Ingress) ([]*netv1alpha1.Ingress, error) {
+	ingresses := make([]*netv1alpha1.Ingress, 0, len(all))
+	for _, ing := range all {
+		nsLabels, err := namespaceLabels(c.namespaceLister, ing.Namespace)
 		if err != nil {
 			return nil, err
 		}
+		if gatewayConfig.LookupGatewayFor(ing, nsLabels, visibility) == gatewayConfig.LookupGateway(visibility) {
+			ingresses = append(ingresses, ing)
+		}
+	}
+	return ingresses, nil
+}
 
-		if !equality.Semantic.DeepEqual(httproute.Spec, desired.Spec) ||
-			!equality.Semantic.DeepEqual(httproute.Annotations, desired.Annotations) ||
-			!equality.Semantic.DeepEqual(httproute.Labels, desired.Labels) {
+// isManaged returns true if the object is provisioned by the controller for
+// the managed Gateways, which are shared by the Ingresses instead of owned.
+func isManaged(obj metav1.Object) bool {
+	return obj.GetLabels()[resources.GatewayManagedLabelKey] == "true"
+}
+
+// listIngresses returns the Ingresses of our class which are not being
+// deleted.
+func (c *Reconciler) listIngresses() ([]*netv1alpha1.Ingress, error) {
+	all, err := c.ingressLister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Ingresses: %w", err)
+	}
+
+	ingresses := make([]*netv1alpha1.Ingress, 0, len(all))
+	for _, ing := range all {
+		if ing.DeletionTimestamp != nil || !ingressClassFilter(ing) {
+			continue
+		}
+		ingresses = append(ingresses, ing)
+	}
+	return ingresses, nil
+}
+
+// reconcileGatewaySecrets copies the TLS secrets referenced by the listeners of
+// the managed Gateway into its namespace. The listeners of the missing origin
+// secrets are left for the Gateway to report as unresolved.
+func (c *Reconciler) reconcileGatewaySecrets(
+	ctx context.Context, gw *gwv1alpha1.Gateway,
+	visibility netv1alpha1.IngressVisibility, ingresses []*netv1alpha1.Ingress,
+) error {
+	copied := sets.NewString()
+	for _, owner := range ingresses {
+		for i := range owner.Spec.TLS {
+			tls := &owner.Spec.TLS[i]
+			name := resources.GatewayTLSSecretName(owner, tls)
+			if copied.Has(name) || len(resources.TLSHosts(owner, tls, visibility)) == 0 {
+				continue
+			}
+			copied.Insert(name)
 
-			// Don't modify the informers copy.
-			origin := httproute.DeepCopy()
-			origin.Spec = desired.Spec
-			origin.Annotations = desired.Annotations
-			origin.Labels = desired.Labels
+			originNamespace := tls.SecretNamespace
+			if originNamespace == "" {
+				originNamespace = owner.Namespace
+			}
+			origin, err := c.getOriginSecret(ctx, originNamespace, tls.SecretName)
+			if apierrs.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("failed to get TLS secret %s/%s: %w", originNamespace, tls.SecretName, err)
+			}
+			if err := c.reconcileSecretCopy(ctx, nil, resources.MakeGatewaySecret(gw, name, origin), isManaged); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
-			updated, err := c.gwapiclient.NetworkingV1alpha1().HTTPRoutes(origin.Namespace).Update(
-				ctx, origin, metav1.UpdateOptions{})
-			if err != nil {
-				return nil, fmt.Errorf("failed to update HTTPRoute: %w", err)
+// deleteStaleGatewaySecrets deletes the copies of the TLS secrets in the
+// namespaces of the managed Gateways which none of their listeners reference.
+func (c *Reconciler) deleteStaleGatewaySecrets(ctx context.Context, gateways []*gwv1alpha1.Gateway) error {
+	referenced := make(map[string]sets.String, len(gateways))
+	for _, gw := range gateways {
+		if referenced[gw.Namespace] == nil {
+			referenced[gw.Namespace] = sets.NewString()
+		}
+		for _, l := range gw.Spec.Listeners {
+			if l.TLS != nil && l.TLS.CertificateRef != nil && l.TLS.CertificateRef.Kind == "Secret" {
+				referenced[gw.Namespace].Insert(l.TLS.CertificateRef.Name)
 			}
-			return updated, nil
 		}
 	}
 
-	return httproute, err
+	selector := labels.SelectorFromSet(labels.Set{resources.GatewayManagedLabelKey: "true"})
+	for ns, names := range referenced {
+		secrets, err := c.secretLister.Secrets(ns).List(selector)
+		if err != nil {
+			return fmt.Errorf("failed to list Secrets: %w", err)
+		}
+		for _, secret := range secrets {
+			if names.Has(secret.Name) {
+				continue
+			}
+			if err := c.kubeclient.CoreV1().Secrets(ns).Delete(
+				ctx, secret.Name, metav1.DeleteOptions{}); err != nil && !apierrs.IsNotFound(err) {
+				return fmt.Errorf("failed to delete Secret: %w", err)
+			}
+		}
+	}
+	return nil
 }
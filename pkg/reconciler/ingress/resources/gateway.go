@@ -0,0 +1,223 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+	gwv1alpha1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
+
+	"knative.dev/networking/pkg"
+	"knative.dev/networking/pkg/apis/networking"
+	netv1alpha1 "knative.dev/networking/pkg/apis/networking/v1alpha1"
+	"knative.dev/pkg/kmeta"
+
+	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/config"
+)
+
+// MakeGateway creates the Gateway of the given visibility from the managed
+// gateway configuration, with an HTTPS listener for each TLS host of the
+// given Ingresses. It returns nil when the Gateway is not managed by the
+// controller.
+func MakeGateway(ctx context.Context, visibility netv1alpha1.IngressVisibility,
+	ingresses []*netv1alpha1.Ingress) *gwv1alpha1.Gateway {
+	gatewayConfig := config.FromContext(ctx).Gateway
+	managed := gatewayConfig.LookupManagedGateway(visibility)
+	if managed == nil {
+		return nil
+	}
+	ns, name, _ := cache.SplitMetaNamespaceKey(gatewayConfig.LookupGateway(visibility))
+
+	listeners := make([]gwv1alpha1.Listener, 0, len(managed.Listeners))
+	for _, l := range managed.Listeners {
+		listeners = append(listeners, *l.DeepCopy())
+	}
+	if len(listeners) == 0 {
+		listeners = append(listeners, gwv1alpha1.Listener{
+			Protocol: gwv1alpha1.HTTPProtocolType,
+			Port:     80,
+		})
+	}
+	for i := range listeners {
+		if listeners[i].Routes.Kind == "" {
+			listeners[i].Routes = makeRouteBindingSelector(visibility, listeners[i].Protocol)
+		}
+	}
+	listeners = append(listeners, makeTLSListeners(visibility, managed, ingresses)...)
+
+	var addresses []gwv1alpha1.GatewayAddress
+	for _, a := range managed.Addresses {
+		addresses = append(addresses, *a.DeepCopy())
+	}
+
+	return &gwv1alpha1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ns,
+			Labels: map[string]string{
+				GatewayManagedLabelKey: "true",
+			},
+		},
+		Spec: gwv1alpha1.GatewaySpec{
+			GatewayClassName: gatewayConfig.LookupGatewayClass(visibility),
+			Listeners:        listeners,
+			Addresses:        addresses,
+		},
+	}
+}
+
+// makeRouteBindingSelector selects the HTTPRoutes of the visibility from all
+// namespaces, except the ones restricted to the listeners of the other
+// protocol.
+func makeRouteBindingSelector(visibility netv1alpha1.IngressVisibility,
+	protocol gwv1alpha1.ProtocolType) gwv1alpha1.RouteBindingSelector {
+	other := gwv1alpha1.HTTPProtocolType
+	if protocol == gwv1alpha1.HTTPProtocolType {
+		other = gwv1alpha1.HTTPSProtocolType
+	}
+
+	return gwv1alpha1.RouteBindingSelector{
+		Kind: "HTTPRoute",
+		Selector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				pkg.VisibilityLabelKey: Visibility(visibility),
+			},
+			MatchExpressions: []metav1.LabelSelectorRequirement{{
+				Key:      ListenerProtocolLabelKey,
+				Operator: metav1.LabelSelectorOpNotIn,
+				Values:   []string{string(other)},
+			}},
+		},
+		Namespaces: &gwv1alpha1.RouteNamespaces{
+			From: routeSelectTypePtr(gwv1alpha1.RouteSelectAll),
+		},
+	}
+}
+
+// makeTLSListeners creates an HTTPS listener terminating TLS with the
+// certificate of the Ingress for each TLS host of the visibility. The
+// listeners copy the port and the TLS options of the first HTTPS listener of
+// the managed gateway. A host claimed by several Ingresses is served with the
+// certificate of the first Ingress by namespace and name.
+func makeTLSListeners(visibility netv1alpha1.IngressVisibility, managed *config.ManagedGateway,
+	ingresses []*netv1alpha1.Ingress) []gwv1alpha1.Listener {
+	template := gwv1alpha1.Listener{
+		Protocol: gwv1alpha1.HTTPSProtocolType,
+		Port:     443,
+		TLS: &gwv1alpha1.GatewayTLSConfig{
+			Mode: tlsModeTypePtr(gwv1alpha1.TLSModeTerminate),
+		},
+	}
+	for _, l := range managed.Listeners {
+		if l.Protocol == gwv1alpha1.HTTPSProtocolType {
+			template.Port = l.Port
+			template.TLS = l.TLS.DeepCopy()
+			break
+		}
+	}
+
+	sorted := make([]*netv1alpha1.Ingress, len(ingresses))
+	copy(sorted, ingresses)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Namespace != sorted[j].Namespace {
+			return sorted[i].Namespace < sorted[j].Namespace
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	listeners := make(map[string]gwv1alpha1.Listener)
+	for _, ing := range sorted {
+		for i := range ing.Spec.TLS {
+			tls := &ing.Spec.TLS[i]
+			for _, host := range TLSHosts(ing, tls, visibility) {
+				if _, ok := listeners[host]; ok {
+					continue
+				}
+				l := *template.DeepCopy()
+				l.Hostname = hostnamePtr(host)
+				l.TLS.CertificateRef = &gwv1alpha1.LocalObjectReference{
+					Group: "core",
+					Kind:  "Secret",
+					Name:  GatewayTLSSecretName(ing, tls),
+				}
+				l.Routes = makeRouteBindingSelector(visibility, gwv1alpha1.HTTPSProtocolType)
+				listeners[host] = l
+			}
+		}
+	}
+
+	hosts := make([]string, 0, len(listeners))
+	for host := range listeners {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	ret := make([]gwv1alpha1.Listener, 0, len(hosts))
+	for _, host := range hosts {
+		ret = append(ret, listeners[host])
+	}
+	return ret
+}
+
+// TLSHosts returns the hosts of the TLS entry which are served by the rules
+// of the Ingress with the given visibility.
+func TLSHosts(ing *netv1alpha1.Ingress, tls *netv1alpha1.IngressTLS,
+	visibility netv1alpha1.IngressVisibility) []string {
+	hosts := sets.NewString()
+	for _, rule := range ing.Spec.Rules {
+		if rule.Visibility == visibility {
+			hosts.Insert(rule.Hosts...)
+		}
+	}
+	return hosts.Intersection(sets.NewString(tls.Hosts...)).List()
+}
+
+// GatewayTLSSecretName returns the name of the secret which the listeners of
+// the Gateway reference for the given TLS entry. Gateway listeners can only
+// reference a secret in the Gateway namespace, so the origin secrets are
+// copied there under a name derived from the origin secret.
+func GatewayTLSSecretName(ing *netv1alpha1.Ingress, tls *netv1alpha1.IngressTLS) string {
+	ns := tls.SecretNamespace
+	if ns == "" {
+		ns = ing.Namespace
+	}
+	return kmeta.ChildName(ns+"-"+tls.SecretName, originSecretSuffix(ns, tls.SecretName))
+}
+
+// MakeGatewaySecret creates a copy of the origin secret in the namespace of
+// the Gateway. The copies are shared by all Ingresses using the origin secret,
+// so they are labelled instead of owned by an Ingress.
+func MakeGatewaySecret(gw *gwv1alpha1.Gateway, name string, origin *corev1.Secret) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: gw.Namespace,
+			Labels: map[string]string{
+				GatewayManagedLabelKey:                   "true",
+				networking.OriginSecretNameLabelKey:      origin.Name,
+				networking.OriginSecretNamespaceLabelKey: origin.Namespace,
+			},
+		},
+		Data: origin.Data,
+		Type: origin.Type,
+	}
+}
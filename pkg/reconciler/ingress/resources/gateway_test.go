@@ -0,0 +1,314 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/networking/pkg/apis/networking"
+	"knative.dev/networking/pkg/apis/networking/v1alpha1"
+	gwv1alpha1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
+
+	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/config"
+)
+
+func TestMakeGateway(t *testing.T) {
+	namedAddress := gwv1alpha1.NamedAddressType
+	terminate := gwv1alpha1.TLSModeTerminate
+	sameNamespace := gwv1alpha1.RouteSelectSame
+
+	for _, tc := range []struct {
+		name       string
+		visibility v1alpha1.IngressVisibility
+		managed    *config.ManagedGateway
+		ingresses  []*v1alpha1.Ingress
+		want       *gwv1alpha1.Gateway
+	}{{
+		name:       "not managed",
+		visibility: v1alpha1.IngressVisibilityExternalIP,
+	}, {
+		name:       "default listener",
+		visibility: v1alpha1.IngressVisibilityClusterLocal,
+		managed:    &config.ManagedGateway{},
+		want: &gwv1alpha1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo-local",
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					GatewayManagedLabelKey: "true",
+				},
+			},
+			Spec: gwv1alpha1.GatewaySpec{
+				GatewayClassName: testGatewayClass,
+				Listeners: []gwv1alpha1.Listener{{
+					Protocol: gwv1alpha1.HTTPProtocolType,
+					Port:     80,
+					Routes:   routesOf("cluster-local", "HTTPS"),
+				}},
+			},
+		},
+	}, {
+		name:       "HTTP and HTTPS listeners",
+		visibility: v1alpha1.IngressVisibilityExternalIP,
+		managed: &config.ManagedGateway{
+			Addresses: []gwv1alpha1.GatewayAddress{{
+				Type:  &namedAddress,
+				Value: "istio-ingressgateway",
+			}},
+			Listeners: []gwv1alpha1.Listener{{
+				Protocol: gwv1alpha1.HTTPProtocolType,
+				Port:     80,
+			}, {
+				Protocol: gwv1alpha1.HTTPSProtocolType,
+				Port:     443,
+				TLS:      &gwv1alpha1.GatewayTLSConfig{Mode: &terminate},
+			}},
+		},
+		want: &gwv1alpha1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					GatewayManagedLabelKey: "true",
+				},
+			},
+			Spec: gwv1alpha1.GatewaySpec{
+				GatewayClassName: testGatewayClass,
+				Addresses: []gwv1alpha1.GatewayAddress{{
+					Type:  &namedAddress,
+					Value: "istio-ingressgateway",
+				}},
+				Listeners: []gwv1alpha1.Listener{{
+					Protocol: gwv1alpha1.HTTPProtocolType,
+					Port:     80,
+					Routes:   routesOf("", "HTTPS"),
+				}, {
+					Protocol: gwv1alpha1.HTTPSProtocolType,
+					Port:     443,
+					TLS:      &gwv1alpha1.GatewayTLSConfig{Mode: &terminate},
+					Routes:   routesOf("", "HTTP"),
+				}},
+			},
+		},
+	}, {
+		name:       "route selector kept",
+		visibility: v1alpha1.IngressVisibilityExternalIP,
+		managed: &config.ManagedGateway{
+			Listeners: []gwv1alpha1.Listener{{
+				Protocol: gwv1alpha1.HTTPProtocolType,
+				Port:     8080,
+				Routes: gwv1alpha1.RouteBindingSelector{
+					Kind:       "HTTPRoute",
+					Namespaces: &gwv1alpha1.RouteNamespaces{From: &sameNamespace},
+				},
+			}},
+		},
+		want: &gwv1alpha1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					GatewayManagedLabelKey: "true",
+				},
+			},
+			Spec: gwv1alpha1.GatewaySpec{
+				GatewayClassName: testGatewayClass,
+				Listeners: []gwv1alpha1.Listener{{
+					Protocol: gwv1alpha1.HTTPProtocolType,
+					Port:     8080,
+					Routes: gwv1alpha1.RouteBindingSelector{
+						Kind:       "HTTPRoute",
+						Namespaces: &gwv1alpha1.RouteNamespaces{From: &sameNamespace},
+					},
+				}},
+			},
+		},
+	}, {
+		name:       "TLS listeners",
+		visibility: v1alpha1.IngressVisibilityExternalIP,
+		managed: &config.ManagedGateway{
+			Listeners: []gwv1alpha1.Listener{{
+				Protocol: gwv1alpha1.HTTPSProtocolType,
+				Port:     8443,
+				TLS:      &gwv1alpha1.GatewayTLSConfig{Mode: &terminate},
+			}},
+		},
+		ingresses: []*v1alpha1.Ingress{
+			tlsIngress("b", "b.example.com", "b-cert", v1alpha1.IngressVisibilityExternalIP),
+			tlsIngress("a", "a.example.com", "a-cert", v1alpha1.IngressVisibilityExternalIP),
+			// The host is already served with the certificate of "a".
+			tlsIngress("c", "a.example.com", "c-cert", v1alpha1.IngressVisibilityExternalIP),
+			tlsIngress("d", "d.example.com", "d-cert", v1alpha1.IngressVisibilityClusterLocal),
+		},
+		want: &gwv1alpha1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					GatewayManagedLabelKey: "true",
+				},
+			},
+			Spec: gwv1alpha1.GatewaySpec{
+				GatewayClassName: testGatewayClass,
+				Listeners: []gwv1alpha1.Listener{{
+					Protocol: gwv1alpha1.HTTPSProtocolType,
+					Port:     8443,
+					TLS:      &gwv1alpha1.GatewayTLSConfig{Mode: &terminate},
+					Routes:   routesOf("", "HTTP"),
+				}, {
+					Hostname: hostnamePtr("a.example.com"),
+					Protocol: gwv1alpha1.HTTPSProtocolType,
+					Port:     8443,
+					TLS: &gwv1alpha1.GatewayTLSConfig{
+						Mode: &terminate,
+						CertificateRef: &gwv1alpha1.LocalObjectReference{
+							Group: "core",
+							Kind:  "Secret",
+							Name:  testNamespace + "-a-cert-d8cfa703a17d4f6b",
+						},
+					},
+					Routes: routesOf("", "HTTP"),
+				}, {
+					Hostname: hostnamePtr("b.example.com"),
+					Protocol: gwv1alpha1.HTTPSProtocolType,
+					Port:     8443,
+					TLS: &gwv1alpha1.GatewayTLSConfig{
+						Mode: &terminate,
+						CertificateRef: &gwv1alpha1.LocalObjectReference{
+							Group: "core",
+							Kind:  "Secret",
+							Name:  testNamespace + "-b-cert-428a393dca7c2f56",
+						},
+					},
+					Routes: routesOf("", "HTTP"),
+				}},
+			},
+		},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig.DeepCopy()
+			cfg.Gateway.Gateways[tc.visibility].Managed = tc.managed
+			ctx := (&testConfigStore{config: cfg}).ToContext(context.Background())
+
+			got := MakeGateway(ctx, tc.visibility, tc.ingresses)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Error("Unexpected Gateway (-want, +got):", diff)
+			}
+		})
+	}
+}
+
+func TestMakeGatewaySecret(t *testing.T) {
+	gw := &gwv1alpha1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "istio-system",
+		},
+	}
+	origin := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "origin",
+			Namespace: testNamespace,
+		},
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       []byte("cert"),
+			corev1.TLSPrivateKeyKey: []byte("key"),
+		},
+		Type: corev1.SecretTypeTLS,
+	}
+
+	want := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-ns-origin-4847a68dfc47b450",
+			Namespace: "istio-system",
+			Labels: map[string]string{
+				GatewayManagedLabelKey:                   "true",
+				networking.OriginSecretNameLabelKey:      "origin",
+				networking.OriginSecretNamespaceLabelKey: testNamespace,
+			},
+		},
+		Data: origin.Data,
+		Type: corev1.SecretTypeTLS,
+	}
+
+	name := GatewayTLSSecretName(&v1alpha1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace},
+	}, &v1alpha1.IngressTLS{SecretName: "origin"})
+	if diff := cmp.Diff(want, MakeGatewaySecret(gw, name, origin)); diff != "" {
+		t.Error("Unexpected Secret (-want, +got):", diff)
+	}
+}
+
+func TestGatewayTLSSecretName(t *testing.T) {
+	name := func(ns, secret string) string {
+		return GatewayTLSSecretName(&v1alpha1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns},
+		}, &v1alpha1.IngressTLS{SecretName: secret})
+	}
+
+	// Both origin secrets join to "a-b-c".
+	if a, b := name("a-b", "c"), name("a", "b-c"); a == b {
+		t.Errorf("GatewayTLSSecretName() = %q for both a-b/c and a/b-c", a)
+	}
+	if got, want := name("a", "b"), GatewayTLSSecretName(&v1alpha1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "other"},
+	}, &v1alpha1.IngressTLS{SecretNamespace: "a", SecretName: "b"}); got != want {
+		t.Errorf("GatewayTLSSecretName() = %q, want %q for the secret namespace", got, want)
+	}
+}
+
+func tlsIngress(name, host, secret string, visibility v1alpha1.IngressVisibility) *v1alpha1.Ingress {
+	return &v1alpha1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespace,
+		},
+		Spec: v1alpha1.IngressSpec{
+			Rules: []v1alpha1.IngressRule{{
+				Hosts:      []string{host},
+				Visibility: visibility,
+			}},
+			TLS: []v1alpha1.IngressTLS{{
+				Hosts:      []string{host},
+				SecretName: secret,
+			}},
+		},
+	}
+}
+
+func routesOf(visibility, excluded string) gwv1alpha1.RouteBindingSelector {
+	return gwv1alpha1.RouteBindingSelector{
+		Kind: "HTTPRoute",
+		Selector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				"networking.knative.dev/visibility": visibility,
+			},
+			MatchExpressions: []metav1.LabelSelectorRequirement{{
+				Key:      ListenerProtocolLabelKey,
+				Operator: metav1.LabelSelectorOpNotIn,
+				Values:   []string{excluded},
+			}},
+		},
+		Namespaces: &gwv1alpha1.RouteNamespaces{
+			From: routeSelectTypePtr(gwv1alpha1.RouteSelectAll),
+		},
+	}
+}
@@ -17,12 +17,42 @@ limitations under the License.
 package resources
 
 import (
-	"sort"
-
 	netv1alpha1 "knative.dev/networking/pkg/apis/networking/v1alpha1"
 	gwv1alpha1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
 )
 
+const (
+	// ListenerProtocolLabelKey is the label to restrict an HTTPRoute to the
+	// Gateway listeners of the given protocol. The routes without the label
+	// are served by both HTTP and HTTPS listeners.
+	ListenerProtocolLabelKey = "gateway-api.networking.knative.dev/listener-protocol"
+
+	// GatewayManagedLabelKey is the label of the Gateways which are
+	// provisioned from config-gateway and kept in sync by the controller.
+	GatewayManagedLabelKey = "gateway-api.networking.knative.dev/managed"
+
+	// ACMEChallengePathPrefix is the path prefix of the ACME HTTP-01
+	// challenges which Knative adds to the Ingresses with autoTLS.
+	ACMEChallengePathPrefix = "/.well-known/acme-challenge/"
+
+	// HostHeader is the request header which carries the RewriteHost of the
+	// paths to their backends when the GatewayClass has no host rewrite
+	// filter.
+	HostHeader = "Host"
+
+	// RewriteHostHeader is the request header which carries the RewriteHost
+	// of the paths to the host rewrite filter of the GatewayClass, which sets
+	// the Host header from it.
+	RewriteHostHeader = "K-Rewrite-Host"
+
+	// MirrorAnnotationKey is the annotation of the Ingress to mirror the
+	// requests of its paths to a shadow Service of the Ingress namespace.
+	// The value is the name of the Service, optionally followed by ":" and
+	// the port, e.g. "shadow:80". Serving propagates the annotation from the
+	// Knative Service through the Route to the Ingress.
+	MirrorAnnotationKey = "gateway-api.networking.knative.dev/mirror"
+)
+
 // Visibility converts netv1alpha1.IngressVisibility to string.
 func Visibility(visibility netv1alpha1.IngressVisibility) string {
 	switch visibility {
@@ -51,15 +81,19 @@ func pathMatchTypePtr(val gwv1alpha1.PathMatchType) *gwv1alpha1.PathMatchType {
 	return &val
 }
 
-func stringPtr(s string) *string {
-	return &s
+func routeSelectTypePtr(val gwv1alpha1.RouteSelectType) *gwv1alpha1.RouteSelectType {
+	return &val
 }
 
-// LongestHost returns the "longest" host.
-// The length is:
-// 1. the length of the hostnames.
-// 2. the first alphabetical order.
-func LongestHost(hosts []string) string {
-	sort.Strings(hosts)
-	return hosts[0]
+func hostnamePtr(host string) *gwv1alpha1.Hostname {
+	h := gwv1alpha1.Hostname(host)
+	return &h
+}
+
+func tlsModeTypePtr(val gwv1alpha1.TLSModeType) *gwv1alpha1.TLSModeType {
+	return &val
+}
+
+func stringPtr(s string) *string {
+	return &s
 }
@@ -18,50 +18,179 @@ package resources
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/utils/pointer"
 	gwv1alpha1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
 
 	"knative.dev/networking/pkg"
+	"knative.dev/networking/pkg/apis/networking"
 	netv1alpha1 "knative.dev/networking/pkg/apis/networking/v1alpha1"
 	"knative.dev/pkg/kmeta"
 
 	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/config"
 )
 
-// MakeHTTPRoute creates HTTPRoute to set up routing rules.
+// MakeHTTPRoute creates HTTPRoute to set up routing rules for the rule at
+// the given index of the Ingress.
 func MakeHTTPRoute(
 	ctx context.Context,
 	ing *netv1alpha1.Ingress,
-	rule *netv1alpha1.IngressRule,
+	index int,
 ) (*gwv1alpha1.HTTPRoute, error) {
+	rule := &ing.Spec.Rules[index]
+
+	mirror, err := MakeRequestMirror(ing)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{
+		pkg.VisibilityLabelKey: Visibility(rule.Visibility),
+	}
+	if IsHTTPRedirected(ing, rule) && config.FromContext(ctx).Gateway.LookupHTTPRedirect(rule.Visibility) != nil {
+		// The plain HTTP requests are served by the redirect route. Without
+		// the redirect filter, the route serves them instead.
+		labels[ListenerProtocolLabelKey] = string(gwv1alpha1.HTTPSProtocolType)
+	}
 
-	visibility := ""
-	if rule.Visibility == netv1alpha1.IngressVisibilityClusterLocal {
-		visibility = "cluster-local"
+	spec := makeHTTPRouteSpec(ctx, ing, rule)
+	if mirror != nil {
+		addRequestMirror(spec.Rules, mirror)
 	}
 
 	return &gwv1alpha1.HTTPRoute{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      LongestHost(rule.Hosts),
-			Namespace: ing.Namespace,
-			Labels: kmeta.UnionMaps(ing.Labels, map[string]string{
-				pkg.VisibilityLabelKey: visibility,
-			}),
-			Annotations: kmeta.FilterMap(ing.GetAnnotations(), func(key string) bool {
-				return key == corev1.LastAppliedConfigAnnotation
-			}),
-			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(ing)},
-		},
-		Spec: makeHTTPRouteSpec(ctx, rule),
+		ObjectMeta: makeHTTPRouteMeta(ing, HTTPRouteName(ing, index), labels),
+		Spec:       spec,
 	}, nil
 }
 
+// MakeRequestMirror creates the filter to mirror the requests to the Service
+// of the mirror annotation of the Ingress. It returns nil when the Ingress
+// has no mirror annotation. The requests are always mirrored in full: the
+// RequestMirror filter of v1alpha1 has no fraction to mirror a percentage.
+func MakeRequestMirror(ing *netv1alpha1.Ingress) (*gwv1alpha1.HTTPRequestMirrorFilter, error) {
+	value := ing.Annotations[MirrorAnnotationKey]
+	if value == "" {
+		return nil, nil
+	}
+
+	name, port := value, ""
+	if i := strings.LastIndex(value, ":"); i >= 0 {
+		name, port = value[:i], value[i+1:]
+	}
+	if name == "" {
+		return nil, fmt.Errorf("annotation %q has no Service name: %q", MirrorAnnotationKey, value)
+	}
+
+	mirror := &gwv1alpha1.HTTPRequestMirrorFilter{ServiceName: &name}
+	if port != "" {
+		p, err := strconv.Atoi(port)
+		if err != nil || p < 1 || p > 65535 {
+			return nil, fmt.Errorf("annotation %q has an invalid port: %q", MirrorAnnotationKey, value)
+		}
+		mirror.Port = portNumPtr(p)
+	}
+	return mirror, nil
+}
+
+// addRequestMirror adds the mirror filter to the rules, except for the ACME
+// HTTP-01 challenges which are not served by the Ingress backends.
+func addRequestMirror(rules []gwv1alpha1.HTTPRouteRule, mirror *gwv1alpha1.HTTPRequestMirrorFilter) {
+	for i := range rules {
+		if isACMEChallengeRule(&rules[i]) {
+			continue
+		}
+		rules[i].Filters = append(rules[i].Filters, gwv1alpha1.HTTPRouteFilter{
+			Type:          gwv1alpha1.HTTPRouteFilterRequestMirror,
+			RequestMirror: mirror.DeepCopy(),
+		})
+	}
+}
+
+func isACMEChallengeRule(rule *gwv1alpha1.HTTPRouteRule) bool {
+	for _, match := range rule.Matches {
+		if match.Path != nil && match.Path.Value != nil &&
+			strings.HasPrefix(*match.Path.Value, ACMEChallengePathPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// MakeRedirectHTTPRoute creates HTTPRoute to redirect the plain HTTP requests
+// of the rule at the given index to HTTPS, except for the ACME HTTP-01
+// challenges. It returns nil when no redirect filter is configured for the
+// rule's visibility.
+func MakeRedirectHTTPRoute(
+	ctx context.Context,
+	ing *netv1alpha1.Ingress,
+	index int,
+) (*gwv1alpha1.HTTPRoute, error) {
+	rule := &ing.Spec.Rules[index]
+	redirect := config.FromContext(ctx).Gateway.LookupHTTPRedirect(rule.Visibility)
+	if redirect == nil {
+		return nil, nil
+	}
+
+	labels := map[string]string{
+		pkg.VisibilityLabelKey:   Visibility(rule.Visibility),
+		ListenerProtocolLabelKey: string(gwv1alpha1.HTTPProtocolType),
+	}
+
+	spec := makeHTTPRouteSpec(ctx, ing, rule)
+	spec.TLS = nil
+	// The ACME HTTP-01 challenges are served over plain HTTP.
+	hostRewrite := config.FromContext(ctx).Gateway.LookupHostRewrite(rule.Visibility)
+	spec.Rules = append(makeACMEChallengeRules(rule, hostRewrite), gwv1alpha1.HTTPRouteRule{
+		Matches: []gwv1alpha1.HTTPRouteMatch{{
+			Path: &gwv1alpha1.HTTPPathMatch{
+				Type:  pathMatchTypePtr(gwv1alpha1.PathMatchPrefix),
+				Value: pointer.StringPtr("/"),
+			},
+		}},
+		Filters: []gwv1alpha1.HTTPRouteFilter{{
+			Type:         gwv1alpha1.HTTPRouteFilterExtensionRef,
+			ExtensionRef: redirect.DeepCopy(),
+		}},
+	})
+
+	return &gwv1alpha1.HTTPRoute{
+		ObjectMeta: makeHTTPRouteMeta(ing, RedirectHTTPRouteName(ing, index), labels),
+		Spec:       spec,
+	}, nil
+}
+
+// IsHTTPRedirected returns true when the plain HTTP requests of the rule
+// need to be redirected to HTTPS.
+func IsHTTPRedirected(ing *netv1alpha1.Ingress, rule *netv1alpha1.IngressRule) bool {
+	return ing.Spec.HTTPOption == netv1alpha1.HTTPOptionRedirected &&
+		rule.Visibility == netv1alpha1.IngressVisibilityExternalIP
+}
+
+func makeHTTPRouteMeta(ing *netv1alpha1.Ingress, name string, labels map[string]string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: ing.Namespace,
+		Labels: kmeta.UnionMaps(ing.Labels, labels, map[string]string{
+			networking.IngressLabelKey: ing.Name,
+		}),
+		Annotations: kmeta.FilterMap(ing.GetAnnotations(), func(key string) bool {
+			return key == corev1.LastAppliedConfigAnnotation
+		}),
+		OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(ing)},
+	}
+}
+
 func makeHTTPRouteSpec(
 	ctx context.Context,
+	ing *netv1alpha1.Ingress,
 	rule *netv1alpha1.IngressRule,
 ) gwv1alpha1.HTTPRouteSpec {
 
@@ -70,89 +199,182 @@ func makeHTTPRouteSpec(
 		hostnames = append(hostnames, gwv1alpha1.Hostname(hostname))
 	}
 
-	rules := makeHTTPRouteRule(rule)
-
 	gatewayConfig := config.FromContext(ctx).Gateway
-	ns, name, _ := cache.SplitMetaNamespaceKey(gatewayConfig.LookupGateway(rule.Visibility))
+	rules := makeHTTPRouteRule(rule, gatewayConfig.LookupHostRewrite(rule.Visibility))
 
-	gatewayRef := gwv1alpha1.GatewayReference{
-		Namespace: ns,
-		Name:      name,
+	keys := gatewayConfig.LookupGatewaysFor(ing, config.NamespaceLabelsFromContext(ctx), rule.Visibility)
+
+	gatewayRefs := make([]gwv1alpha1.GatewayReference, 0, len(keys))
+	for _, key := range keys {
+		ns, name, _ := cache.SplitMetaNamespaceKey(key)
+		gatewayRefs = append(gatewayRefs, gwv1alpha1.GatewayReference{
+			Namespace: ns,
+			Name:      name,
+		})
 	}
 
 	return gwv1alpha1.HTTPRouteSpec{
 		Hostnames: hostnames,
 		Rules:     rules,
+		TLS:       makeRouteTLS(ing, rule),
 		Gateways: &gwv1alpha1.RouteGateways{
 			Allow:       gatewayAllowTypePtr(gwv1alpha1.GatewayAllowFromList),
-			GatewayRefs: []gwv1alpha1.GatewayReference{gatewayRef},
+			GatewayRefs: gatewayRefs,
 		},
 	}
 }
 
-func makeHTTPRouteRule(rule *netv1alpha1.IngressRule) []gwv1alpha1.HTTPRouteRule {
+// makeRouteTLS returns the TLS configuration of the first IngressTLS which
+// covers any of the rule's hosts. HTTPRoute can hold a single certificate
+// only, so the remaining matching entries are ignored.
+func makeRouteTLS(ing *netv1alpha1.Ingress, rule *netv1alpha1.IngressRule) *gwv1alpha1.RouteTLSConfig {
+	hosts := sets.NewString(rule.Hosts...)
+	for i := range ing.Spec.TLS {
+		tls := &ing.Spec.TLS[i]
+		if !hosts.HasAny(tls.Hosts...) {
+			continue
+		}
+		return &gwv1alpha1.RouteTLSConfig{
+			CertificateRef: gwv1alpha1.LocalObjectReference{
+				Group: "core",
+				Kind:  "Secret",
+				Name:  TLSSecretName(ing, tls),
+			},
+		}
+	}
+	return nil
+}
+
+// makeHTTPRouteRule creates the rules of the paths of the Ingress rule. The
+// ACME HTTP-01 challenge paths come first so that they take precedence over
+// the other paths.
+func makeHTTPRouteRule(
+	rule *netv1alpha1.IngressRule,
+	hostRewrite *gwv1alpha1.LocalObjectReference,
+) []gwv1alpha1.HTTPRouteRule {
+	challenges := makeACMEChallengeRules(rule, hostRewrite)
+	rules := make([]gwv1alpha1.HTTPRouteRule, 0, len(rule.HTTP.Paths))
+	for i := range rule.HTTP.Paths {
+		if !IsACMEChallenge(&rule.HTTP.Paths[i]) {
+			rules = append(rules, makeHTTPRoutePathRule(&rule.HTTP.Paths[i], hostRewrite))
+		}
+	}
+	return append(challenges, rules...)
+}
+
+// makeACMEChallengeRules creates the rules of the ACME HTTP-01 challenge paths
+// of the Ingress rule.
+func makeACMEChallengeRules(
+	rule *netv1alpha1.IngressRule,
+	hostRewrite *gwv1alpha1.LocalObjectReference,
+) []gwv1alpha1.HTTPRouteRule {
 	rules := []gwv1alpha1.HTTPRouteRule{}
+	for i := range rule.HTTP.Paths {
+		if IsACMEChallenge(&rule.HTTP.Paths[i]) {
+			rules = append(rules, makeHTTPRoutePathRule(&rule.HTTP.Paths[i], hostRewrite))
+		}
+	}
+	return rules
+}
+
+// IsACMEChallenge returns true if the path serves an ACME HTTP-01 challenge,
+// which must stay reachable over plain HTTP.
+func IsACMEChallenge(path *netv1alpha1.HTTPIngressPath) bool {
+	return strings.HasPrefix(path.Path, ACMEChallengePathPrefix)
+}
+
+// makeHTTPRoutePathRule creates the rule of the path. No retry or timeout
+// policy is attached: HTTPIngressPath carries neither (HTTPRetry is deprecated
+// and unused by KIngress), and the retry conformance test expects the failed
+// requests not to be retried.
+func makeHTTPRoutePathRule(
+	path *netv1alpha1.HTTPIngressPath,
+	hostRewrite *gwv1alpha1.LocalObjectReference,
+) gwv1alpha1.HTTPRouteRule {
+	var forwards []gwv1alpha1.HTTPRouteForwardTo
+	var preFilters []gwv1alpha1.HTTPRouteFilter
 
-	for _, path := range rule.HTTP.Paths {
-		var forwards []gwv1alpha1.HTTPRouteForwardTo
-		var preFilters []gwv1alpha1.HTTPRouteFilter
+	if path.AppendHeaders != nil {
+		preFilters = []gwv1alpha1.HTTPRouteFilter{{
+			Type: gwv1alpha1.HTTPRouteFilterRequestHeaderModifier,
+			RequestHeaderModifier: &gwv1alpha1.HTTPRequestHeaderFilter{
+				Set: path.AppendHeaders,
+			}}}
+	}
 
-		if path.AppendHeaders != nil {
-			preFilters = []gwv1alpha1.HTTPRouteFilter{{
+	// The host is rewritten by the host rewrite filter of the GatewayClass,
+	// which takes it from the RewriteHostHeader set ahead of it. Without
+	// the filter, the host is rewritten through the Host header, which the
+	// gateways map onto the authority of HTTP/2 requests, and which some of
+	// them refuse to modify. Pseudo-headers like :authority are not valid
+	// header names, and are rejected or ignored by some gateways.
+	set := map[string]string{}
+	if path.RewriteHost != "" && hostRewrite != nil {
+		preFilters = []gwv1alpha1.HTTPRouteFilter{{
+			Type: gwv1alpha1.HTTPRouteFilterRequestHeaderModifier,
+			RequestHeaderModifier: &gwv1alpha1.HTTPRequestHeaderFilter{
+				Set: kmeta.UnionMaps(path.AppendHeaders, map[string]string{RewriteHostHeader: path.RewriteHost}),
+			},
+		}, {
+			Type:         gwv1alpha1.HTTPRouteFilterExtensionRef,
+			ExtensionRef: hostRewrite.DeepCopy(),
+		}}
+	} else if path.RewriteHost != "" {
+		set = map[string]string{HostHeader: path.RewriteHost}
+	}
+	for _, split := range path.Splits {
+		// ServiceNamespace is not needed: the validation of the Ingress
+		// requires it to match the Ingress namespace, where the HTTPRoute
+		// lives too.
+		name := split.IngressBackend.ServiceName
+		forward := gwv1alpha1.HTTPRouteForwardTo{
+			Port:        portNumPtr(split.ServicePort.IntValue()),
+			ServiceName: &name,
+			Weight:      pointer.Int32Ptr(int32(split.Percent)),
+			Filters: []gwv1alpha1.HTTPRouteFilter{{
 				Type: gwv1alpha1.HTTPRouteFilterRequestHeaderModifier,
 				RequestHeaderModifier: &gwv1alpha1.HTTPRequestHeaderFilter{
-					Set: path.AppendHeaders,
-				}}}
-		}
+					Set: kmeta.UnionMaps(split.AppendHeaders, set),
+				}},
+			}}
+		forwards = append(forwards, forward)
+	}
 
-		set := map[string]string{}
-		if path.RewriteHost != "" {
-			set = map[string]string{"Host": path.RewriteHost, ":Authority": path.RewriteHost}
-		}
-		for _, split := range path.Splits {
-			name := split.IngressBackend.ServiceName
-			forward := gwv1alpha1.HTTPRouteForwardTo{
-				Port:        portNumPtr(split.ServicePort.IntValue()),
-				ServiceName: &name,
-				Weight:      pointer.Int32Ptr(int32(split.Percent)),
-				Filters: []gwv1alpha1.HTTPRouteFilter{{
-					Type: gwv1alpha1.HTTPRouteFilterRequestHeaderModifier,
-					RequestHeaderModifier: &gwv1alpha1.HTTPRequestHeaderFilter{
-						Set: kmeta.UnionMaps(split.AppendHeaders, set),
-					}},
-				}}
-			forwards = append(forwards, forward)
-		}
+	pathPrefix := "/"
+	if path.Path != "" {
+		pathPrefix = path.Path
+	}
+	pathMatch := gwv1alpha1.HTTPPathMatch{
+		Type:  pathMatchTypePtr(gwv1alpha1.PathMatchPrefix),
+		Value: pointer.StringPtr(pathPrefix),
+	}
+	if IsACMEChallenge(path) {
+		// The challenge token is the whole path, and an exact match
+		// wins over the prefixes of the other rules.
+		pathMatch.Type = pathMatchTypePtr(gwv1alpha1.PathMatchExact)
+	}
 
-		pathPrefix := "/"
-		if path.Path != "" {
-			pathPrefix = path.Path
+	// HeaderMatch of KIngress supports exact values only. The tag header based
+	// routing needs nothing more: Serving expresses it as exact matches of the
+	// Knative-Serving-Tag header, and sets Knative-Serving-Default-Route
+	// through AppendHeaders.
+	var headersMatch *gwv1alpha1.HTTPHeaderMatch
+	if path.Headers != nil {
+		header := map[string]string{}
+		for k, v := range path.Headers {
+			header[k] = v.Exact
 		}
-		pathMatch := gwv1alpha1.HTTPPathMatch{
-			Type:  pathMatchTypePtr(gwv1alpha1.PathMatchPrefix),
-			Value: pointer.StringPtr(pathPrefix),
-		}
-
-		var headersMatch *gwv1alpha1.HTTPHeaderMatch
-		if path.Headers != nil {
-			header := map[string]string{}
-			for k, v := range path.Headers {
-				header[k] = v.Exact
-			}
-			headersMatch = &gwv1alpha1.HTTPHeaderMatch{
-				Type:   headerMatchTypePtr(gwv1alpha1.HeaderMatchExact),
-				Values: header,
-			}
+		headersMatch = &gwv1alpha1.HTTPHeaderMatch{
+			Type:   headerMatchTypePtr(gwv1alpha1.HeaderMatchExact),
+			Values: header,
 		}
+	}
 
-		matches := []gwv1alpha1.HTTPRouteMatch{{Path: &pathMatch, Headers: headersMatch}}
+	matches := []gwv1alpha1.HTTPRouteMatch{{Path: &pathMatch, Headers: headersMatch}}
 
-		rule := gwv1alpha1.HTTPRouteRule{
-			ForwardTo: forwards,
-			Filters:   preFilters,
-			Matches:   matches,
-		}
-		rules = append(rules, rule)
+	return gwv1alpha1.HTTPRouteRule{
+		ForwardTo: forwards,
+		Filters:   preFilters,
+		Matches:   matches,
 	}
-	return rules
 }
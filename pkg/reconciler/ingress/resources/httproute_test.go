@@ -138,7 +138,7 @@ func TestMakeHTTPRoute(t *testing.T) {
 			expected: []*gwv1alpha1.HTTPRoute{
 				{
 					ObjectMeta: metav1.ObjectMeta{
-						Name:      LongestHost(testHosts),
+						Name:      testIngressName + "-external-0",
 						Namespace: testNamespace,
 						Labels: map[string]string{
 							networking.IngressLabelKey:          testIngressName,
@@ -193,7 +193,7 @@ func TestMakeHTTPRoute(t *testing.T) {
 					},
 				}, {
 					ObjectMeta: metav1.ObjectMeta{
-						Name:      LongestHost(testLocalHosts),
+						Name:      testIngressName + "-cluster-local-1",
 						Namespace: testNamespace,
 						Labels: map[string]string{
 							networking.IngressLabelKey:          testIngressName,
@@ -295,7 +295,7 @@ func TestMakeHTTPRoute(t *testing.T) {
 			},
 			expected: []*gwv1alpha1.HTTPRoute{{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:      LongestHost(testHosts),
+					Name:      testIngressName + "-external-0",
 					Namespace: testNamespace,
 					Labels: map[string]string{
 						networking.IngressLabelKey:          testIngressName,
@@ -390,7 +390,7 @@ func TestMakeHTTPRoute(t *testing.T) {
 			},
 			expected: []*gwv1alpha1.HTTPRoute{{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:      LongestHost(testHosts),
+					Name:      testIngressName + "-external-0",
 					Namespace: testNamespace,
 					Labels: map[string]string{
 						networking.IngressLabelKey:          testIngressName,
@@ -409,12 +409,22 @@ func TestMakeHTTPRoute(t *testing.T) {
 								Filters: []gwv1alpha1.HTTPRouteFilter{{
 									Type: gwv1alpha1.HTTPRouteFilterRequestHeaderModifier,
 									RequestHeaderModifier: &gwv1alpha1.HTTPRequestHeaderFilter{
-										Set: map[string]string{
-											":Authority": "foo.com",
-											"Host":       "foo.com",
-										},
+										Set: map[string]string{},
 									}}},
 							}},
+							Filters: []gwv1alpha1.HTTPRouteFilter{{
+								Type: gwv1alpha1.HTTPRouteFilterRequestHeaderModifier,
+								RequestHeaderModifier: &gwv1alpha1.HTTPRequestHeaderFilter{
+									Set: map[string]string{RewriteHostHeader: "foo.com"},
+								},
+							}, {
+								Type: gwv1alpha1.HTTPRouteFilterExtensionRef,
+								ExtensionRef: &gwv1alpha1.LocalObjectReference{
+									Group: "example.com",
+									Kind:  "HostRewrite",
+									Name:  "auto",
+								},
+							}},
 							Matches: []gwv1alpha1.HTTPRouteMatch{
 								{
 									Path: &gwv1alpha1.HTTPPathMatch{
@@ -435,12 +445,11 @@ func TestMakeHTTPRoute(t *testing.T) {
 			}},
 		}} {
 		t.Run(tc.name, func(t *testing.T) {
-			for i, rule := range tc.ci.Spec.Rules {
-				rule := rule
+			for i := range tc.ci.Spec.Rules {
 				tcs := &testConfigStore{config: testConfig}
 				ctx := tcs.ToContext(context.Background())
 
-				route, err := MakeHTTPRoute(ctx, tc.ci, &rule)
+				route, err := MakeHTTPRoute(ctx, tc.ci, i)
 				if err != nil {
 					t.Fatal("MakeHTTPRoute failed:", err)
 				}
@@ -472,7 +481,456 @@ var testConfig = &config.Config{
 				GatewayClass: testGatewayClass,
 				Gateway:      "test-ns/foo-local",
 			},
-		}},
+		},
+		HostRewrites: map[string]gwv1alpha1.LocalObjectReference{
+			testGatewayClass: {
+				Group: "example.com",
+				Kind:  "HostRewrite",
+				Name:  "auto",
+			},
+		},
+	},
 }
 
 var _ reconciler.ConfigStore = (*testConfigStore)(nil)
+
+func TestMakeHTTPRouteHostRewriteWithoutFilter(t *testing.T) {
+	noFilterConfig := testConfig.DeepCopy()
+	noFilterConfig.Gateway.HostRewrites = nil
+	ctx := (&testConfigStore{config: noFilterConfig}).ToContext(context.Background())
+
+	ing := testIngress(func(ing *v1alpha1.Ingress) {
+		ing.Spec.Rules[0].HTTP.Paths[0].RewriteHost = "foo.com"
+	})
+	route, err := MakeHTTPRoute(ctx, ing, 0)
+	if err != nil {
+		t.Fatal("MakeHTTPRoute() =", err)
+	}
+	if got := route.Spec.Rules[0].Filters; len(got) != 0 {
+		t.Errorf("Rule has filters %v, want none", got)
+	}
+	want := []gwv1alpha1.HTTPRouteFilter{{
+		Type: gwv1alpha1.HTTPRouteFilterRequestHeaderModifier,
+		RequestHeaderModifier: &gwv1alpha1.HTTPRequestHeaderFilter{
+			Set: map[string]string{HostHeader: "foo.com"},
+		},
+	}}
+	if diff := cmp.Diff(want, route.Spec.Rules[0].ForwardTo[0].Filters); diff != "" {
+		t.Error("Filters (-want, +got) =", diff)
+	}
+}
+
+func TestMakeHTTPRouteTLS(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		tls      []v1alpha1.IngressTLS
+		expected *gwv1alpha1.RouteTLSConfig
+	}{{
+		name: "no TLS",
+	}, {
+		name: "TLS in the same namespace",
+		tls: []v1alpha1.IngressTLS{{
+			Hosts:           testHosts,
+			SecretName:      "secret0",
+			SecretNamespace: testNamespace,
+		}},
+		expected: &gwv1alpha1.RouteTLSConfig{
+			CertificateRef: gwv1alpha1.LocalObjectReference{
+				Group: "core",
+				Kind:  "Secret",
+				Name:  "secret0",
+			},
+		},
+	}, {
+		name: "TLS in another namespace",
+		tls: []v1alpha1.IngressTLS{{
+			Hosts:           testHosts,
+			SecretName:      "secret0",
+			SecretNamespace: "knative-serving",
+		}},
+		expected: &gwv1alpha1.RouteTLSConfig{
+			CertificateRef: gwv1alpha1.LocalObjectReference{
+				Group: "core",
+				Kind:  "Secret",
+				Name:  testIngressName + "-knative-serving-secret0-2c2cd07b769f7459",
+			},
+		},
+	}, {
+		name: "TLS for other hosts",
+		tls: []v1alpha1.IngressTLS{{
+			Hosts:           []string{"other.example.com"},
+			SecretName:      "secret0",
+			SecretNamespace: testNamespace,
+		}, {
+			Hosts:           testHosts,
+			SecretName:      "secret1",
+			SecretNamespace: testNamespace,
+		}},
+		expected: &gwv1alpha1.RouteTLSConfig{
+			CertificateRef: gwv1alpha1.LocalObjectReference{
+				Group: "core",
+				Kind:  "Secret",
+				Name:  "secret1",
+			},
+		},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			ing := testIngress(withTLS(tc.tls...))
+			tcs := &testConfigStore{config: testConfig}
+			ctx := tcs.ToContext(context.Background())
+
+			route, err := MakeHTTPRoute(ctx, ing, 0)
+			if err != nil {
+				t.Fatal("MakeHTTPRoute failed:", err)
+			}
+			if diff := cmp.Diff(tc.expected, route.Spec.TLS); diff != "" {
+				t.Error("Unexpected TLS (-want +got):", diff)
+			}
+		})
+	}
+}
+
+func TestMakeRedirectHTTPRoute(t *testing.T) {
+	redirect := &gwv1alpha1.LocalObjectReference{
+		Group: "example.com",
+		Kind:  "Redirect",
+		Name:  "https",
+	}
+	redirectConfig := testConfig.DeepCopy()
+	redirectConfig.Gateway.Gateways[v1alpha1.IngressVisibilityExternalIP].HTTPRedirect = redirect
+
+	ing := testIngress(withHTTPOption(v1alpha1.HTTPOptionRedirected))
+
+	for _, tc := range []struct {
+		name     string
+		config   *config.Config
+		protocol string
+		expected *gwv1alpha1.HTTPRoute
+	}{{
+		// The route serves the plain HTTP requests too.
+		name:   "no redirect filter",
+		config: testConfig,
+	}, {
+		name:     "redirect filter",
+		config:   redirectConfig,
+		protocol: "HTTPS",
+		expected: &gwv1alpha1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      testIngressName + "-external-0-redirect",
+				Namespace: testNamespace,
+				Labels: map[string]string{
+					networking.IngressLabelKey:          testIngressName,
+					"networking.knative.dev/visibility": "",
+					ListenerProtocolLabelKey:            "HTTP",
+				},
+				Annotations:     map[string]string{},
+				OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(ing)},
+			},
+			Spec: gwv1alpha1.HTTPRouteSpec{
+				Hostnames: []gwv1alpha1.Hostname{externalHost},
+				Rules: []gwv1alpha1.HTTPRouteRule{{
+					Matches: []gwv1alpha1.HTTPRouteMatch{{Path: &gwv1alpha1.HTTPPathMatch{
+						Type:  pathMatchTypePtr(gwv1alpha1.PathMatchPrefix),
+						Value: pointer.StringPtr("/"),
+					}}},
+					Filters: []gwv1alpha1.HTTPRouteFilter{{
+						Type:         gwv1alpha1.HTTPRouteFilterExtensionRef,
+						ExtensionRef: redirect,
+					}},
+				}},
+				Gateways: &gwv1alpha1.RouteGateways{
+					Allow: gatewayAllowTypePtr(gwv1alpha1.GatewayAllowFromList),
+					GatewayRefs: []gwv1alpha1.GatewayReference{{
+						Namespace: "test-ns",
+						Name:      "foo",
+					}},
+				},
+			},
+		},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			tcs := &testConfigStore{config: tc.config}
+			ctx := tcs.ToContext(context.Background())
+
+			route, err := MakeHTTPRoute(ctx, ing, 0)
+			if err != nil {
+				t.Fatal("MakeHTTPRoute failed:", err)
+			}
+			if got, want := route.Labels[ListenerProtocolLabelKey], tc.protocol; got != want {
+				t.Errorf("Label %s = %q, want %q", ListenerProtocolLabelKey, got, want)
+			}
+
+			redirectRoute, err := MakeRedirectHTTPRoute(ctx, ing, 0)
+			if err != nil {
+				t.Fatal("MakeRedirectHTTPRoute failed:", err)
+			}
+			if diff := cmp.Diff(tc.expected, redirectRoute); diff != "" {
+				t.Error("Unexpected HTTPRoute (-want +got):", diff)
+			}
+		})
+	}
+}
+
+func TestMakeHTTPRouteACMEChallenge(t *testing.T) {
+	redirectConfig := testConfig.DeepCopy()
+	redirectConfig.Gateway.Gateways[v1alpha1.IngressVisibilityExternalIP].HTTPRedirect = &gwv1alpha1.LocalObjectReference{
+		Group: "example.com",
+		Kind:  "Redirect",
+		Name:  "https",
+	}
+	ctx := (&testConfigStore{config: redirectConfig}).ToContext(context.Background())
+
+	challenge := ACMEChallengePathPrefix + "token"
+	ing := testIngress(withHTTPOption(v1alpha1.HTTPOptionRedirected), withPath(challenge, "solver", 8089))
+
+	challengeMatch := []gwv1alpha1.HTTPRouteMatch{{Path: &gwv1alpha1.HTTPPathMatch{
+		Type:  pathMatchTypePtr(gwv1alpha1.PathMatchExact),
+		Value: pointer.StringPtr(challenge),
+	}}}
+	catchAllMatch := []gwv1alpha1.HTTPRouteMatch{{Path: &gwv1alpha1.HTTPPathMatch{
+		Type:  pathMatchTypePtr(gwv1alpha1.PathMatchPrefix),
+		Value: pointer.StringPtr("/"),
+	}}}
+
+	route, err := MakeHTTPRoute(ctx, ing, 0)
+	if err != nil {
+		t.Fatal("MakeHTTPRoute failed:", err)
+	}
+	if got := matchesOf(route); !cmp.Equal(got, [][]gwv1alpha1.HTTPRouteMatch{challengeMatch, catchAllMatch}) {
+		t.Error("Unexpected matches of HTTPRoute (-want +got):",
+			cmp.Diff([][]gwv1alpha1.HTTPRouteMatch{challengeMatch, catchAllMatch}, got))
+	}
+
+	redirect, err := MakeRedirectHTTPRoute(ctx, ing, 0)
+	if err != nil {
+		t.Fatal("MakeRedirectHTTPRoute failed:", err)
+	}
+	if got := matchesOf(redirect); !cmp.Equal(got, [][]gwv1alpha1.HTTPRouteMatch{challengeMatch, catchAllMatch}) {
+		t.Error("Unexpected matches of redirect HTTPRoute (-want +got):",
+			cmp.Diff([][]gwv1alpha1.HTTPRouteMatch{challengeMatch, catchAllMatch}, got))
+	}
+	if got := *redirect.Spec.Rules[0].ForwardTo[0].ServiceName; got != "solver" {
+		t.Errorf("Challenge of redirect HTTPRoute is forwarded to %q, want %q", got, "solver")
+	}
+	if got := redirect.Spec.Rules[1].Filters[0].Type; got != gwv1alpha1.HTTPRouteFilterExtensionRef {
+		t.Errorf("Catch-all of redirect HTTPRoute has filter %q, want %q", got, gwv1alpha1.HTTPRouteFilterExtensionRef)
+	}
+
+	// Without a redirect filter, the challenges are served over plain HTTP by
+	// the HTTPRoute, which then attaches to all the listeners.
+	ctx = (&testConfigStore{config: testConfig}).ToContext(context.Background())
+	if redirect, err := MakeRedirectHTTPRoute(ctx, ing, 0); err != nil || redirect != nil {
+		t.Fatalf("MakeRedirectHTTPRoute() = (%v, %v), want (nil, nil)", redirect, err)
+	}
+	route, err = MakeHTTPRoute(ctx, ing, 0)
+	if err != nil {
+		t.Fatal("MakeHTTPRoute failed:", err)
+	}
+	if got, ok := route.Labels[ListenerProtocolLabelKey]; ok {
+		t.Errorf("HTTPRoute without redirect filter is labelled for listener protocol %q", got)
+	}
+	if got := matchesOf(route); !cmp.Equal(got, [][]gwv1alpha1.HTTPRouteMatch{challengeMatch, catchAllMatch}) {
+		t.Error("Unexpected matches of HTTPRoute without redirect filter (-want +got):",
+			cmp.Diff([][]gwv1alpha1.HTTPRouteMatch{challengeMatch, catchAllMatch}, got))
+	}
+}
+
+func matchesOf(route *gwv1alpha1.HTTPRoute) [][]gwv1alpha1.HTTPRouteMatch {
+	matches := make([][]gwv1alpha1.HTTPRouteMatch, 0, len(route.Spec.Rules))
+	for _, rule := range route.Spec.Rules {
+		matches = append(matches, rule.Matches)
+	}
+	return matches
+}
+
+func TestMakeHTTPRouteAdditionalGateways(t *testing.T) {
+	vpnConfig := testConfig.DeepCopy()
+	vpnConfig.Gateway.Gateways[v1alpha1.IngressVisibilityExternalIP].AdditionalGateways = []config.AdditionalGateway{{
+		Gateway: "vpn/vpn-gateway",
+		Service: "vpn/vpn-ingressgateway",
+	}}
+	ctx := (&testConfigStore{config: vpnConfig}).ToContext(context.Background())
+
+	route, err := MakeHTTPRoute(ctx, testIngress(), 0)
+	if err != nil {
+		t.Fatal("MakeHTTPRoute() =", err)
+	}
+	want := []gwv1alpha1.GatewayReference{{
+		Namespace: "test-ns",
+		Name:      "foo",
+	}, {
+		Namespace: "vpn",
+		Name:      "vpn-gateway",
+	}}
+	if diff := cmp.Diff(want, route.Spec.Gateways.GatewayRefs); diff != "" {
+		t.Error("GatewayRefs (-want, +got) =", diff)
+	}
+}
+
+func TestMakeRequestMirror(t *testing.T) {
+	tests := []struct {
+		name       string
+		annotation string
+		want       *gwv1alpha1.HTTPRequestMirrorFilter
+		wantErr    bool
+	}{{
+		name: "no annotation",
+	}, {
+		name:       "service",
+		annotation: "shadow",
+		want:       &gwv1alpha1.HTTPRequestMirrorFilter{ServiceName: stringPtr("shadow")},
+	}, {
+		name:       "service and port",
+		annotation: "shadow:8080",
+		want: &gwv1alpha1.HTTPRequestMirrorFilter{
+			ServiceName: stringPtr("shadow"),
+			Port:        portNumPtr(8080),
+		},
+	}, {
+		name:       "no service",
+		annotation: ":8080",
+		wantErr:    true,
+	}, {
+		name:       "invalid port",
+		annotation: "shadow:http",
+		wantErr:    true,
+	}, {
+		name:       "port out of range",
+		annotation: "shadow:65536",
+		wantErr:    true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ing := &v1alpha1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      testIngressName,
+					Namespace: testNamespace,
+				},
+			}
+			if tc.annotation != "" {
+				ing.Annotations = map[string]string{MirrorAnnotationKey: tc.annotation}
+			}
+
+			got, err := MakeRequestMirror(ing)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("MakeRequestMirror() = %v, wantErr %v", err, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Error("MakeRequestMirror (-want, +got) =", diff)
+			}
+		})
+	}
+}
+
+func TestMakeHTTPRouteRequestMirror(t *testing.T) {
+	ctx := (&testConfigStore{config: testConfig}).ToContext(context.Background())
+
+	ing := testIngress(withMirrorAnnotation("shadow:80"), withAppendHeaders(map[string]string{"Foo": "bar"}),
+		withPath(ACMEChallengePathPrefix+"token", "solver", 8089))
+
+	route, err := MakeHTTPRoute(ctx, ing, 0)
+	if err != nil {
+		t.Fatal("MakeHTTPRoute() =", err)
+	}
+	if got := route.Spec.Rules[0].Filters; len(got) != 0 {
+		t.Errorf("Challenge rule has filters %v, want none", got)
+	}
+	want := []gwv1alpha1.HTTPRouteFilter{{
+		Type: gwv1alpha1.HTTPRouteFilterRequestHeaderModifier,
+		RequestHeaderModifier: &gwv1alpha1.HTTPRequestHeaderFilter{
+			Set: map[string]string{"Foo": "bar"},
+		},
+	}, {
+		Type: gwv1alpha1.HTTPRouteFilterRequestMirror,
+		RequestMirror: &gwv1alpha1.HTTPRequestMirrorFilter{
+			ServiceName: stringPtr("shadow"),
+			Port:        portNumPtr(80),
+		},
+	}}
+	if diff := cmp.Diff(want, route.Spec.Rules[1].Filters); diff != "" {
+		t.Error("Filters (-want, +got) =", diff)
+	}
+
+	ing.Annotations[MirrorAnnotationKey] = "shadow:http"
+	if _, err := MakeHTTPRoute(ctx, ing, 0); err == nil {
+		t.Error("MakeHTTPRoute() = nil, want an error for the invalid mirror annotation")
+	}
+}
+
+type IngressOption func(*v1alpha1.Ingress)
+
+// testIngress returns an Ingress with a single external rule on testHosts,
+// whose single path forwards all the requests to port 123 of goo.
+func testIngress(opts ...IngressOption) *v1alpha1.Ingress {
+	ing := &v1alpha1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testIngressName,
+			Namespace: testNamespace,
+		},
+		Spec: v1alpha1.IngressSpec{
+			Rules: []v1alpha1.IngressRule{{
+				Hosts:      testHosts,
+				Visibility: v1alpha1.IngressVisibilityExternalIP,
+				HTTP: &v1alpha1.HTTPIngressRuleValue{
+					Paths: []v1alpha1.HTTPIngressPath{{
+						Splits: []v1alpha1.IngressBackendSplit{{
+							IngressBackend: v1alpha1.IngressBackend{
+								ServiceName: "goo",
+								ServicePort: intstr.FromInt(123),
+							},
+							Percent: 100,
+						}},
+					}},
+				},
+			}},
+		},
+	}
+	for _, opt := range opts {
+		opt(ing)
+	}
+	return ing
+}
+
+func withTLS(tls ...v1alpha1.IngressTLS) IngressOption {
+	return func(ing *v1alpha1.Ingress) {
+		ing.Spec.TLS = tls
+	}
+}
+
+func withHTTPOption(option v1alpha1.HTTPOption) IngressOption {
+	return func(ing *v1alpha1.Ingress) {
+		ing.Spec.HTTPOption = option
+	}
+}
+
+func withMirrorAnnotation(value string) IngressOption {
+	return func(ing *v1alpha1.Ingress) {
+		ing.Annotations = map[string]string{MirrorAnnotationKey: value}
+	}
+}
+
+// withAppendHeaders sets the headers to append to the requests of the first
+// path.
+func withAppendHeaders(headers map[string]string) IngressOption {
+	return func(ing *v1alpha1.Ingress) {
+		ing.Spec.Rules[0].HTTP.Paths[0].AppendHeaders = headers
+	}
+}
+
+// withPath adds a path to the first rule, which routes it to the given
+// service.
+func withPath(path, service string, port int) IngressOption {
+	return func(ing *v1alpha1.Ingress) {
+		ing.Spec.Rules[0].HTTP.Paths = append(ing.Spec.Rules[0].HTTP.Paths, v1alpha1.HTTPIngressPath{
+			Path: path,
+			Splits: []v1alpha1.IngressBackendSplit{{
+				IngressBackend: v1alpha1.IngressBackend{
+					ServiceName: service,
+					ServicePort: intstr.FromInt(port),
+				},
+				Percent: 100,
+			}},
+		})
+	}
+}
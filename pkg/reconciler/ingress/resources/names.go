@@ -0,0 +1,57 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"fmt"
+	"sort"
+
+	netv1alpha1 "knative.dev/networking/pkg/apis/networking/v1alpha1"
+	"knative.dev/pkg/kmeta"
+)
+
+// HTTPRouteName returns the name of the HTTPRoute generated for the rule at
+// the given index of the Ingress. The name is unique per rule, so the rules
+// sharing hosts never overwrite each other.
+func HTTPRouteName(ing *netv1alpha1.Ingress, index int) string {
+	return kmeta.ChildName(ing.Name, httpRouteSuffix(ing, index))
+}
+
+// RedirectHTTPRouteName returns the name of the HTTPRoute which redirects the
+// plain HTTP requests of the rule at the given index of the Ingress.
+func RedirectHTTPRouteName(ing *netv1alpha1.Ingress, index int) string {
+	return kmeta.ChildName(ing.Name, httpRouteSuffix(ing, index)+"-redirect")
+}
+
+// LegacyHTTPRouteName returns the name which older versions used for the
+// HTTPRoute of a rule: the first of its hosts in alphabetical order.
+func LegacyHTTPRouteName(hosts []string) string {
+	if len(hosts) == 0 {
+		return ""
+	}
+	sorted := append([]string(nil), hosts...)
+	sort.Strings(sorted)
+	return sorted[0]
+}
+
+func httpRouteSuffix(ing *netv1alpha1.Ingress, index int) string {
+	visibility := "external"
+	if ing.Spec.Rules[index].Visibility == netv1alpha1.IngressVisibilityClusterLocal {
+		visibility = "cluster-local"
+	}
+	return fmt.Sprintf("-%s-%d", visibility, index)
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"knative.dev/networking/pkg/apis/networking/v1alpha1"
+)
+
+func TestHTTPRouteName(t *testing.T) {
+	ing := &v1alpha1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testIngressName,
+			Namespace: testNamespace,
+		},
+		Spec: v1alpha1.IngressSpec{
+			Rules: []v1alpha1.IngressRule{{
+				Hosts:      testLocalHosts,
+				Visibility: v1alpha1.IngressVisibilityClusterLocal,
+			}, {
+				Hosts:      testLocalHosts,
+				Visibility: v1alpha1.IngressVisibilityExternalIP,
+			}, {
+				Hosts:      testHosts,
+				Visibility: v1alpha1.IngressVisibilityExternalIP,
+			}},
+		},
+	}
+
+	want := []string{
+		testIngressName + "-cluster-local-0",
+		testIngressName + "-external-1",
+		testIngressName + "-external-2",
+	}
+	names := sets.NewString()
+	for i := range ing.Spec.Rules {
+		got := HTTPRouteName(ing, i)
+		if got != want[i] {
+			t.Errorf("HTTPRouteName(%d) = %q, want %q", i, got, want[i])
+		}
+		names.Insert(got, RedirectHTTPRouteName(ing, i))
+	}
+	if got, want := names.Len(), 2*len(ing.Spec.Rules); got != want {
+		t.Errorf("Got %d unique names, want %d: %v", got, want, names.List())
+	}
+
+	long := ing.DeepCopy()
+	long.Name = strings.Repeat("a", 63)
+	if got := RedirectHTTPRouteName(long, 2); len(got) > 63 {
+		t.Errorf("RedirectHTTPRouteName() = %q, longer than 63 characters", got)
+	}
+}
+
+func TestLegacyHTTPRouteName(t *testing.T) {
+	hosts := []string{"b.example.com", "a.example.com"}
+	if got, want := LegacyHTTPRouteName(hosts), "a.example.com"; got != want {
+		t.Errorf("LegacyHTTPRouteName() = %q, want %q", got, want)
+	}
+	if diff := cmp.Diff([]string{"b.example.com", "a.example.com"}, hosts); diff != "" {
+		t.Error("LegacyHTTPRouteName mutated the hosts (-want, +got):", diff)
+	}
+}
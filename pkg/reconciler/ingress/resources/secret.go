@@ -0,0 +1,68 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"knative.dev/networking/pkg/apis/networking"
+	netv1alpha1 "knative.dev/networking/pkg/apis/networking/v1alpha1"
+	"knative.dev/pkg/kmeta"
+)
+
+// TLSSecretName returns the name of the secret which HTTPRoutes of the Ingress
+// reference for the given TLS entry. HTTPRoute can only reference a secret in
+// its own namespace, so the secrets living in a different namespace are copied
+// into the Ingress namespace under a name derived from the Ingress and the
+// origin secret.
+func TLSSecretName(ing *netv1alpha1.Ingress, tls *netv1alpha1.IngressTLS) string {
+	if tls.SecretNamespace == "" || tls.SecretNamespace == ing.Namespace {
+		return tls.SecretName
+	}
+	return kmeta.ChildName(ing.Name+"-"+tls.SecretNamespace+"-"+tls.SecretName,
+		originSecretSuffix(tls.SecretNamespace, tls.SecretName))
+}
+
+// originSecretSuffix returns the suffix of the names of the copies of the
+// origin secret: a hash of its namespace/name, as the namespace and the name
+// joined by a dash are ambiguous.
+func originSecretSuffix(namespace, name string) string {
+	hash := sha256.Sum256([]byte(namespace + "/" + name))
+	return "-" + hex.EncodeToString(hash[:])[:16]
+}
+
+// MakeSecret creates a copy of the origin secret in the Ingress namespace.
+func MakeSecret(ing *netv1alpha1.Ingress, tls *netv1alpha1.IngressTLS, origin *corev1.Secret) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      TLSSecretName(ing, tls),
+			Namespace: ing.Namespace,
+			Labels: map[string]string{
+				networking.IngressLabelKey:               ing.Name,
+				networking.OriginSecretNameLabelKey:      origin.Name,
+				networking.OriginSecretNamespaceLabelKey: origin.Namespace,
+			},
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(ing)},
+		},
+		Data: origin.Data,
+		Type: origin.Type,
+	}
+}
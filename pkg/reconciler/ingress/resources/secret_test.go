@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/networking/pkg/apis/networking"
+	"knative.dev/networking/pkg/apis/networking/v1alpha1"
+	"knative.dev/pkg/kmeta"
+)
+
+func TestMakeSecret(t *testing.T) {
+	ing := &v1alpha1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testIngressName,
+			Namespace: testNamespace,
+		},
+	}
+	tls := &v1alpha1.IngressTLS{
+		Hosts:           testHosts,
+		SecretName:      "origin",
+		SecretNamespace: "knative-serving",
+	}
+	origin := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "origin",
+			Namespace: "knative-serving",
+		},
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       []byte("cert"),
+			corev1.TLSPrivateKeyKey: []byte("key"),
+		},
+		Type: corev1.SecretTypeTLS,
+	}
+
+	want := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testIngressName + "-knative-serving-origin-6d7adcc3d5f3c574",
+			Namespace: testNamespace,
+			Labels: map[string]string{
+				networking.IngressLabelKey:               testIngressName,
+				networking.OriginSecretNameLabelKey:      "origin",
+				networking.OriginSecretNamespaceLabelKey: "knative-serving",
+			},
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(ing)},
+		},
+		Data: origin.Data,
+		Type: corev1.SecretTypeTLS,
+	}
+
+	if got := MakeSecret(ing, tls, origin); !cmp.Equal(want, got) {
+		t.Error("MakeSecret (-want, +got) =", cmp.Diff(want, got))
+	}
+}
+
+func TestTLSSecretName(t *testing.T) {
+	ing := &v1alpha1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testIngressName,
+			Namespace: testNamespace,
+		},
+	}
+	for _, tc := range []struct {
+		name string
+		tls  *v1alpha1.IngressTLS
+		want string
+	}{{
+		name: "same namespace",
+		tls:  &v1alpha1.IngressTLS{SecretName: "secret", SecretNamespace: testNamespace},
+		want: "secret",
+	}, {
+		name: "empty namespace",
+		tls:  &v1alpha1.IngressTLS{SecretName: "secret"},
+		want: "secret",
+	}, {
+		name: "another namespace",
+		tls:  &v1alpha1.IngressTLS{SecretName: "secret", SecretNamespace: "knative-serving"},
+		want: testIngressName + "-knative-serving-secret-3848933753057bbb",
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := TLSSecretName(ing, tc.tls); got != tc.want {
+				t.Errorf("TLSSecretName() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	// Both origin secrets join to "a-b-c".
+	if a, b := TLSSecretName(ing, &v1alpha1.IngressTLS{SecretNamespace: "a-b", SecretName: "c"}),
+		TLSSecretName(ing, &v1alpha1.IngressTLS{SecretNamespace: "a", SecretName: "b-c"}); a == b {
+		t.Errorf("TLSSecretName() = %q for both a-b/c and a/b-c", a)
+	}
+}
@@ -18,9 +18,11 @@ package ingress
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	fakekubeclientset "k8s.io/client-go/kubernetes/fake"
 	corev1listers "k8s.io/client-go/listers/core/v1"
+	discoveryv1listers "k8s.io/client-go/listers/discovery/v1"
 	"k8s.io/client-go/tools/cache"
 	gwv1alpha1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
 
@@ -95,7 +97,32 @@ func (l *Listers) GetHTTPRouteLister() gwlisters.HTTPRouteLister {
 	return gwlisters.NewHTTPRouteLister(l.IndexerFor(&gwv1alpha1.HTTPRoute{}))
 }
 
-// GetEndpointsLister get lister for K8s Endpoints resource.
-func (l *Listers) GetEndpointsLister() corev1listers.EndpointsLister {
-	return corev1listers.NewEndpointsLister(l.IndexerFor(&corev1.Endpoints{}))
+// GetEndpointSliceLister get lister for K8s EndpointSlice resource.
+func (l *Listers) GetEndpointSliceLister() discoveryv1listers.EndpointSliceLister {
+	return discoveryv1listers.NewEndpointSliceLister(l.IndexerFor(&discoveryv1.EndpointSlice{}))
+}
+
+// GetSecretLister get lister for K8s Secret resource.
+func (l *Listers) GetSecretLister() corev1listers.SecretLister {
+	return corev1listers.NewSecretLister(l.IndexerFor(&corev1.Secret{}))
+}
+
+// GetGatewayLister get lister for Gateway resource.
+func (l *Listers) GetGatewayLister() gwlisters.GatewayLister {
+	return gwlisters.NewGatewayLister(l.IndexerFor(&gwv1alpha1.Gateway{}))
+}
+
+// GetServiceLister get lister for K8s Service resource.
+func (l *Listers) GetServiceLister() corev1listers.ServiceLister {
+	return corev1listers.NewServiceLister(l.IndexerFor(&corev1.Service{}))
+}
+
+// GetGatewayClassLister get lister for GatewayClass resource.
+func (l *Listers) GetGatewayClassLister() gwlisters.GatewayClassLister {
+	return gwlisters.NewGatewayClassLister(l.IndexerFor(&gwv1alpha1.GatewayClass{}))
+}
+
+// GetNamespaceLister get lister for K8s Namespace resource.
+func (l *Listers) GetNamespaceLister() corev1listers.NamespaceLister {
+	return corev1listers.NewNamespaceLister(l.IndexerFor(&corev1.Namespace{}))
 }
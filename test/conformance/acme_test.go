@@ -0,0 +1,113 @@
+// +build e2e
+
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conformance
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"knative.dev/networking/pkg/apis/networking"
+	"knative.dev/networking/pkg/apis/networking/v1alpha1"
+	"knative.dev/networking/test"
+	"knative.dev/networking/test/conformance/ingress"
+
+	"github.com/nak3/net-gateway-api/pkg/reconciler/ingress/config"
+)
+
+// systemNamespace is the namespace of config-gateway.
+const systemNamespace = "knative-serving"
+
+// TestACMEChallenge verifies that the ACME HTTP-01 challenge paths are served
+// over plain HTTP while the other requests are redirected to HTTPS. The
+// requests are only redirected when config-gateway has a redirect filter,
+// which the gateways set up by this repository do not ship.
+func TestACMEChallenge(t *testing.T) {
+	t.Parallel()
+	ctx, clients := context.Background(), test.Setup(t)
+
+	name, port, _ := ingress.CreateRuntimeService(ctx, t, clients, networking.ServicePortNameHTTP1)
+	solver, solverPort, _ := ingress.CreateRuntimeService(ctx, t, clients, networking.ServicePortNameHTTP1)
+
+	hosts := []string{name + ".example.com"}
+	challenge := "/.well-known/acme-challenge/" + solver
+	secretName, tlsConfig, _ := ingress.CreateTLSSecret(ctx, t, clients, hosts)
+
+	_, client, _ := ingress.CreateIngressReadyWithTLS(ctx, t, clients, v1alpha1.IngressSpec{
+		HTTPOption: v1alpha1.HTTPOptionRedirected,
+		Rules: []v1alpha1.IngressRule{{
+			Hosts:      hosts,
+			Visibility: v1alpha1.IngressVisibilityExternalIP,
+			HTTP: &v1alpha1.HTTPIngressRuleValue{
+				Paths: []v1alpha1.HTTPIngressPath{{
+					Splits: []v1alpha1.IngressBackendSplit{{
+						IngressBackend: v1alpha1.IngressBackend{
+							ServiceName:      name,
+							ServiceNamespace: test.ServingNamespace,
+							ServicePort:      intstr.FromInt(port),
+						},
+					}},
+				}, {
+					Path: challenge,
+					Splits: []v1alpha1.IngressBackendSplit{{
+						IngressBackend: v1alpha1.IngressBackend{
+							ServiceName:      solver,
+							ServiceNamespace: test.ServingNamespace,
+							ServicePort:      intstr.FromInt(solverPort),
+						},
+					}},
+				}},
+			},
+		}},
+		TLS: []v1alpha1.IngressTLS{{
+			Hosts:           hosts,
+			SecretName:      secretName,
+			SecretNamespace: test.ServingNamespace,
+		}},
+	}, tlsConfig)
+
+	// Do not follow the redirects.
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	if ri := ingress.RuntimeRequest(ctx, t, client, "http://"+hosts[0]+challenge); ri != nil && ri.Request.URI != challenge {
+		t.Errorf("Challenge request has URI %q, want %q", ri.Request.URI, challenge)
+	}
+
+	cm, err := clients.KubeClient.CoreV1().ConfigMaps(systemNamespace).Get(ctx, config.GatewayConfigName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get ConfigMap %s/%s: %v", systemNamespace, config.GatewayConfigName, err)
+	}
+	gatewayConfig, err := config.NewGatewayFromConfigMap(cm)
+	if err != nil {
+		t.Fatal("Failed to parse config-gateway:", err)
+	}
+	if gatewayConfig.LookupHTTPRedirect(v1alpha1.IngressVisibilityExternalIP) == nil {
+		t.Log("Skipping the redirect of plain HTTP requests: no httpRedirect is configured")
+		return
+	}
+
+	ingress.RuntimeRequestWithExpectations(ctx, t, client, "http://"+hosts[0],
+		[]ingress.ResponseExpectation{ingress.StatusCodeExpectation(sets.NewInt(http.StatusMovedPermanently))},
+		false)
+}